@@ -0,0 +1,73 @@
+package raft
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+var (
+	// ErrChecksumMismatch is returned when the payload of a checksummed
+	// snapshot does not match its checksum.
+	ErrChecksumMismatch = newKindError("raft: snapshot checksum mismatch",
+		ErrSnapshotCorrupt)
+	// ErrUnknownChecksum is returned when a snapshot uses an unsupported
+	// checksum version.
+	ErrUnknownChecksum = newKindError("raft: unknown snapshot checksum version",
+		ErrVersionMismatch)
+	// ErrSnapshotTooShort is returned when a snapshot is shorter than its
+	// header, or than the lengths recorded in it.
+	ErrSnapshotTooShort = newKindError("raft: snapshot is too short",
+		ErrSnapshotCorrupt)
+)
+
+const (
+	// checksumCRC32C is the version of checksum headers using CRC-32 with the
+	// Castagnoli polynomial.
+	checksumCRC32C byte = 1
+
+	checksumHeaderLen = 1 + crc32.Size
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+type checksumPersistent struct {
+	inner Persistent
+}
+
+// ChecksumPersistent returns a Persistent that protects the snapshots of inner
+// with a checksum. Save prepends a header containing a checksum version and the
+// checksum of the inner payload. Restore verifies the checksum and returns
+// ErrChecksumMismatch, without calling inner, if the payload is corrupted.
+func ChecksumPersistent(inner Persistent) Persistent {
+	return checksumPersistent{inner: inner}
+}
+
+func (p checksumPersistent) Save() ([]byte, error) {
+	d, err := p.inner.Save()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, checksumHeaderLen+len(d))
+	b[0] = checksumCRC32C
+	binary.BigEndian.PutUint32(b[1:checksumHeaderLen], crc32.Checksum(d, crc32c))
+	copy(b[checksumHeaderLen:], d)
+	return b, nil
+}
+
+func (p checksumPersistent) Restore(b []byte) error {
+	if len(b) < checksumHeaderLen {
+		return fmt.Errorf("raft: checksum header needs %d bytes, got %d: %w",
+			checksumHeaderLen, len(b), ErrSnapshotTooShort)
+	}
+	if b[0] != checksumCRC32C {
+		return fmt.Errorf("raft: checksum version %d, want %d: %w", b[0],
+			checksumCRC32C, ErrUnknownChecksum)
+	}
+	d := b[checksumHeaderLen:]
+	if binary.BigEndian.Uint32(b[1:checksumHeaderLen]) != crc32.Checksum(d, crc32c) {
+		return fmt.Errorf("raft: crc32c of %d bytes: %w", len(d),
+			ErrChecksumMismatch)
+	}
+	return p.inner.Restore(d)
+}
@@ -0,0 +1,77 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChecksumPersistent(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	b, err := ChecksumPersistent(src).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	dst := NewMapStore()
+	if err = ChecksumPersistent(dst).Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	v, err := dst.Apply(GetCmd{Key: "k"})
+	if err != nil || !bytes.Equal(v.([]byte), []byte("v")) {
+		t.Errorf("invalid restored value: actual=%q,%v want=%q", v, err, "v")
+	}
+}
+
+func TestChecksumPersistentCorrupted(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	b, err := ChecksumPersistent(src).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	for i := 1; i < len(b); i++ {
+		c := append([]byte(nil), b...)
+		c[i] ^= 0x01
+		dst := NewMapStore()
+		if err := ChecksumPersistent(dst).Restore(c); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("flipped byte %d is not detected: %v", i, err)
+		}
+		if dst.Len() != 0 {
+			t.Errorf("corrupted snapshot is restored")
+		}
+	}
+
+	c := append([]byte(nil), b...)
+	c[0] = 0xFF
+	if err := ChecksumPersistent(NewMapStore()).Restore(c); !errors.Is(err,
+		ErrUnknownChecksum) {
+
+		t.Errorf("invalid error for unknown version: actual=%v want=%v", err,
+			ErrUnknownChecksum)
+	}
+	if err := ChecksumPersistent(NewMapStore()).Restore(b[:2]); !errors.Is(err,
+		ErrSnapshotTooShort) {
+
+		t.Errorf("invalid error for short snapshot: actual=%v want=%v", err,
+			ErrSnapshotTooShort)
+	}
+}
+
+func TestWithPersistent(t *testing.T) {
+	s := NewMapStore()
+	sm := WithPersistent(s, ChecksumPersistent(s))
+	sm.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	b, err := sm.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if err := s.Restore(b); err == nil {
+		t.Error("checksummed snapshot restored without verification")
+	}
+	if err := sm.Restore(b); err != nil {
+		t.Errorf("cannot restore: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package raft
+
+import (
+	"encoding/gob"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/golang/glog"
+)
+
+// LogRecord is a request recorded by LoggingStateMachine.
+type LogRecord struct {
+	Time time.Time   // Time is when the request was applied.
+	Req  interface{} // Req is the request.
+}
+
+type loggingStateMachine struct {
+	StateMachine
+
+	mu     sync.Mutex
+	enc    *gob.Encoder
+	failed bool
+}
+
+// LoggingStateMachine returns a state machine that records every request in w
+// before applying it using sm. Requests are encoded as a gob stream of
+// LogRecord, hence their types must be registered using gob.Register.
+//
+// Requests are applied even if they cannot be recorded, since skipping a
+// committed request would make the replicas diverge. The first write error is
+// logged and stops the recording, because a partially written record
+// corrupts the rest of the stream.
+//
+// The recorded stream can be replayed using ReplayLog.
+func LoggingStateMachine(sm StateMachine, w io.Writer) StateMachine {
+	return &loggingStateMachine{
+		StateMachine: sm,
+		enc:          gob.NewEncoder(w),
+	}
+}
+
+func (l *loggingStateMachine) Apply(req interface{}) (interface{}, error) {
+	l.mu.Lock()
+	if !l.failed {
+		err := l.enc.Encode(LogRecord{Time: time.Now(), Req: req})
+		if err != nil {
+			glog.Errorf("cannot record %#v, recording stopped: %v", req, err)
+			l.failed = true
+		}
+	}
+	l.mu.Unlock()
+	return l.StateMachine.Apply(req)
+}
+
+func (l *loggingStateMachine) Reset() error {
+	return Reset(l.StateMachine)
+}
+
+// ReplayLog applies the requests recorded by LoggingStateMachine in r to sm,
+// in the order they were recorded. The errors returned by sm.Apply are
+// ignored, since the same errors were returned when the requests were
+// originally applied. ReplayLog returns nil when it reaches the end of r.
+func ReplayLog(r io.Reader, sm StateMachine) error {
+	dec := gob.NewDecoder(r)
+	for {
+		var rec LogRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		sm.Apply(rec.Req)
+	}
+}
@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestLoggingStateMachineReplay(t *testing.T) {
+	var log bytes.Buffer
+	src := NewMapStore()
+	sm := LoggingStateMachine(src, &log)
+	reqs := []interface{}{
+		SetCmd{Key: "a", Val: []byte("1")},
+		SetCmd{Key: "b", Val: []byte("2")},
+		GetCmd{Key: "none"},
+		DeleteCmd{Key: "a"},
+		SetCmd{Key: "c", Val: []byte("3")},
+		SetCmd{Key: "b", Val: []byte("4")},
+	}
+	for _, req := range reqs {
+		sm.Apply(req)
+	}
+	want, err := sm.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	dst := NewMapStore()
+	if err := ReplayLog(bytes.NewReader(log.Bytes()), dst); err != nil {
+		t.Fatalf("cannot replay: %v", err)
+	}
+	b, err := dst.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Error("replayed store is different from the original one")
+	}
+}
+
+func TestReplayLogCorrupted(t *testing.T) {
+	var log bytes.Buffer
+	sm := LoggingStateMachine(NewMapStore(), &log)
+	sm.Apply(SetCmd{Key: "a", Val: []byte("1")})
+	sm.Apply(SetCmd{Key: "b", Val: []byte("2")})
+
+	b := log.Bytes()
+	if err := ReplayLog(bytes.NewReader(b[:len(b)-1]), NewMapStore()); err ==
+		nil {
+
+		t.Error("no error for a truncated log")
+	}
+}
+
+// testFailingWriter fails all writes after the first n ones. A negative n never
+// fails.
+type testFailingWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *testFailingWriter) Write(b []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return w.Buffer.Write(b)
+}
+
+func TestLoggingStateMachineWriteError(t *testing.T) {
+	w := &testFailingWriter{n: 1}
+	s := NewMapStore()
+	sm := LoggingStateMachine(s, w)
+	for _, k := range []string{"a", "b", "c"} {
+		if _, err := sm.Apply(SetCmd{Key: k}); err != nil {
+			t.Errorf("cannot apply %q: %v", k, err)
+		}
+	}
+	if s.Len() != 3 {
+		t.Errorf("invalid store length: actual=%d want=3", s.Len())
+	}
+
+	// A partial record corrupts the stream, so nothing is recorded after it.
+	l := w.Len()
+	w.n = -1
+	sm.Apply(SetCmd{Key: "d"})
+	if w.Len() != l {
+		t.Errorf("request recorded after a write error")
+	}
+}
@@ -0,0 +1,223 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	// ErrUnregisteredType is returned when a command type is not registered in
+	// the type registry.
+	ErrUnregisteredType = newKindError("raft: unregistered command type",
+		ErrUnknownCommand)
+)
+
+// Codec encodes and decodes the requests and responses sent to peers.
+type Codec interface {
+	// Encode encodes v, which can be nil.
+	Encode(v interface{}) ([]byte, error)
+	// Decode decodes a value encoded by Encode.
+	Decode(b []byte) (interface{}, error)
+}
+
+// TypeRegistry maps the concrete types of encoded values to names, so that
+// codecs can decode them back to the same types.
+type TypeRegistry struct {
+	mu    sync.RWMutex
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+}
+
+// DefaultTypeRegistry is the registry used by codecs created with a nil
+// registry. The commands of MapStore and Counter, as well as the basic Go
+// types, are registered in DefaultTypeRegistry.
+var DefaultTypeRegistry = NewTypeRegistry()
+
+// NewTypeRegistry creates an empty TypeRegistry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		names: make(map[reflect.Type]string),
+		types: make(map[string]reflect.Type),
+	}
+}
+
+// Register registers the concrete type of v using its Go type name, e.g.,
+// "raft.SetCmd". Values of type T and *T are registered separately.
+func (r *TypeRegistry) Register(v interface{}) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		panic("raft: registering a nil type")
+	}
+	r.RegisterName(t.String(), v)
+}
+
+// RegisterName registers the concrete type of v as name. It panics if either
+// name or the type is already registered with a different pair.
+func (r *TypeRegistry) RegisterName(name string, v interface{}) {
+	if name == "" {
+		panic("raft: registering a type with an empty name")
+	}
+	t := reflect.TypeOf(v)
+	if t == nil {
+		panic("raft: registering a nil type")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n, ok := r.names[t]; ok && n != name {
+		panic(fmt.Sprintf("raft: type %v is registered as %q", t, n))
+	}
+	if rt, ok := r.types[name]; ok && rt != t {
+		panic(fmt.Sprintf("raft: name %q is registered for type %v", name, rt))
+	}
+	r.names[t] = name
+	r.types[name] = t
+}
+
+func (r *TypeRegistry) name(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, ok := r.names[reflect.TypeOf(v)]
+	if !ok {
+		return "", fmt.Errorf("raft: cannot encode %T: %w", v, ErrUnregisteredType)
+	}
+	return n, nil
+}
+
+func (r *TypeRegistry) new(name string) (reflect.Value, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.types[name]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("raft: cannot decode %q: %w", name,
+			ErrUnregisteredType)
+	}
+	return reflect.New(t), nil
+}
+
+type jsonEnvelope struct {
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type jsonCodec struct {
+	reg *TypeRegistry
+}
+
+// JSONCodec returns a Codec that encodes values as JSON objects tagged with
+// the name of their type in reg. If reg is nil, DefaultTypeRegistry is used.
+func JSONCodec(reg *TypeRegistry) Codec {
+	if reg == nil {
+		reg = DefaultTypeRegistry
+	}
+	return jsonCodec{reg: reg}
+}
+
+func (c jsonCodec) Encode(v interface{}) ([]byte, error) {
+	n, err := c.reg.name(v)
+	if err != nil {
+		return nil, err
+	}
+	e := jsonEnvelope{Type: n}
+	if v != nil {
+		if e.Value, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(e)
+}
+
+func (c jsonCodec) Decode(b []byte) (interface{}, error) {
+	var e jsonEnvelope
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	if e.Type == "" {
+		return nil, nil
+	}
+	v, err := c.reg.new(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(e.Value, v.Interface()); err != nil {
+		return nil, fmt.Errorf("raft: cannot decode %q: %w", e.Type, err)
+	}
+	return v.Elem().Interface(), nil
+}
+
+type gobEnvelope struct {
+	Type  string
+	Value []byte
+}
+
+type gobCodec struct {
+	reg *TypeRegistry
+}
+
+// GobCodec returns a Codec that encodes values using encoding/gob, tagged with
+// the name of their type in reg. If reg is nil, DefaultTypeRegistry is used.
+// Unlike gob.Register, reg only affects the top-level value: values stored in
+// interface-typed fields must still be registered using gob.Register.
+func GobCodec(reg *TypeRegistry) Codec {
+	if reg == nil {
+		reg = DefaultTypeRegistry
+	}
+	return gobCodec{reg: reg}
+}
+
+func (c gobCodec) Encode(v interface{}) ([]byte, error) {
+	n, err := c.reg.name(v)
+	if err != nil {
+		return nil, err
+	}
+	e := gobEnvelope{Type: n}
+	if v != nil {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		e.Value = buf.Bytes()
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c gobCodec) Decode(b []byte) (interface{}, error) {
+	var e gobEnvelope
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&e); err != nil {
+		return nil, err
+	}
+	if e.Type == "" {
+		return nil, nil
+	}
+	v, err := c.reg.new(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	err = gob.NewDecoder(bytes.NewReader(e.Value)).Decode(v.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("raft: cannot decode %q: %w", e.Type, err)
+	}
+	return v.Elem().Interface(), nil
+}
+
+func init() {
+	for _, v := range []interface{}{
+		false, "", []byte(nil), []string(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+	} {
+		DefaultTypeRegistry.Register(v)
+	}
+}
@@ -0,0 +1,89 @@
+package raft
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testCodecCmd struct {
+	Name string
+	Vals []int
+	Sub  *testInner
+}
+
+func TestCodecs(t *testing.T) {
+	reg := NewTypeRegistry()
+	reg.Register(SetCmd{})
+	reg.Register(IncrCmd{})
+	reg.Register(ValueCmd{})
+	reg.Register(testCodecCmd{})
+	reg.Register(&testCodecCmd{})
+	reg.RegisterName("str", "")
+
+	vals := []interface{}{
+		nil,
+		"value",
+		SetCmd{Key: "k", Val: []byte("v")},
+		IncrCmd{N: -3},
+		ValueCmd{},
+		testCodecCmd{Name: "n", Vals: []int{1, 2}, Sub: &testInner{Name: "s"}},
+		&testCodecCmd{Name: "p"},
+	}
+	codecs := map[string]Codec{
+		"json": JSONCodec(reg),
+		"gob":  GobCodec(reg),
+	}
+	for name, c := range codecs {
+		for _, v := range vals {
+			b, err := c.Encode(v)
+			if err != nil {
+				t.Errorf("%v cannot encode %#v: %v", name, v, err)
+				continue
+			}
+			d, err := c.Decode(b)
+			if err != nil {
+				t.Errorf("%v cannot decode %#v: %v", name, v, err)
+				continue
+			}
+			if !reflect.DeepEqual(d, v) {
+				t.Errorf("invalid %v round trip: actual=%#v want=%#v", name, d, v)
+			}
+		}
+
+		if _, err := c.Encode(DeleteCmd{}); !errors.Is(err, ErrUnregisteredType) {
+			t.Errorf("invalid %v error: actual=%v want=%v", name, err,
+				ErrUnregisteredType)
+		}
+	}
+
+	b, _ := GobCodec(reg).Encode(SetCmd{Key: "k"})
+	if _, err := GobCodec(nil).Decode(b); err != nil {
+		t.Errorf("cannot decode using the default registry: %v", err)
+	}
+	b, _ = GobCodec(reg).Encode("value")
+	if _, err := GobCodec(nil).Decode(b); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrUnknownCommand)
+	}
+}
+
+func TestTypeRegistryConflicts(t *testing.T) {
+	reg := NewTypeRegistry()
+	reg.Register(SetCmd{})
+	reg.Register(SetCmd{})
+
+	for _, f := range []func(){
+		func() { reg.RegisterName("other", SetCmd{}) },
+		func() { reg.RegisterName("raft.SetCmd", GetCmd{}) },
+		func() { reg.Register(nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic for a conflicting registration")
+				}
+			}()
+			f()
+		}()
+	}
+}
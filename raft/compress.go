@@ -0,0 +1,195 @@
+package raft
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+var (
+	// ErrUnknownCompression is returned when a snapshot is compressed with an
+	// unknown codec.
+	ErrUnknownCompression = newKindError("raft: unknown snapshot compression",
+		ErrVersionMismatch)
+)
+
+var compressMagic = []byte("bhzc")
+
+const compressHeaderLen = 4 + 1
+
+// DefaultMaxDecompressedSize is the maximum size of a decompressed snapshot
+// restored by CompressedPersistent.
+const DefaultMaxDecompressedSize int64 = 1 << 30
+
+// CompressionCodec compresses and decompresses snapshots.
+type CompressionCodec interface {
+	// ID returns the unique ID of the codec, stored in the snapshot header.
+	ID() byte
+	// Compress compresses b.
+	Compress(b []byte) ([]byte, error)
+	// Decompress decompresses b. It returns an error wrapping
+	// ErrSnapshotCorrupt if b decompresses to more than max bytes.
+	Decompress(b []byte, max int64) ([]byte, error)
+}
+
+var (
+	// GzipCompression compresses snapshots using gzip.
+	GzipCompression CompressionCodec = gzipCodec{}
+	// FlateCompression compresses snapshots using raw DEFLATE, which has a
+	// smaller header than gzip.
+	FlateCompression CompressionCodec = flateCodec{}
+)
+
+type gzipCodec struct{}
+
+func (c gzipCodec) ID() byte { return 1 }
+
+func (c gzipCodec) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	return compressWith(&buf, w, b)
+}
+
+func (c gzipCodec) Decompress(b []byte, max int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readAtMost(r, max)
+}
+
+type flateCodec struct{}
+
+func (c flateCodec) ID() byte { return 2 }
+
+func (c flateCodec) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	return compressWith(&buf, w, b)
+}
+
+func (c flateCodec) Decompress(b []byte, max int64) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	return readAtMost(r, max)
+}
+
+// readAtMost reads r to the end, and stops as soon as it reads more than max
+// bytes. A small corrupt or malicious input can otherwise decompress to an
+// arbitrarily large snapshot.
+func readAtMost(r io.Reader, max int64) ([]byte, error) {
+	n := max
+	if n < math.MaxInt64 {
+		n++
+	}
+	d, err := ioutil.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(d)) > max {
+		return nil, fmt.Errorf(
+			"raft: decompressed snapshot exceeds %d bytes: %w", max,
+			ErrSnapshotCorrupt)
+	}
+	return d, nil
+}
+
+func compressWith(buf *bytes.Buffer, w io.WriteCloser, b []byte) ([]byte,
+	error) {
+
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type compressedPersistent struct {
+	inner   Persistent
+	codec   CompressionCodec
+	codecs  map[byte]CompressionCodec
+	maxSize int64
+}
+
+// CompressedPersistent returns a Persistent that compresses the snapshots of
+// inner using codec. Restore decompresses snapshots compressed by codec or by
+// any of the built-in codecs, and passes snapshots without a compression
+// header to inner as is. Hence, stores can start compressing their snapshots
+// and still restore the ones saved before. Restore rejects snapshots that
+// decompress to more than DefaultMaxDecompressedSize bytes.
+func CompressedPersistent(inner Persistent,
+	codec CompressionCodec) Persistent {
+
+	return CompressedPersistentMaxSize(inner, codec, DefaultMaxDecompressedSize)
+}
+
+// CompressedPersistentMaxSize is like CompressedPersistent, but Restore rejects
+// snapshots that decompress to more than maxSize bytes with
+// ErrSnapshotCorrupt. maxSize must be positive.
+func CompressedPersistentMaxSize(inner Persistent, codec CompressionCodec,
+	maxSize int64) Persistent {
+
+	if maxSize <= 0 {
+		panic("raft: max decompressed size must be positive")
+	}
+	p := compressedPersistent{
+		inner:   inner,
+		codec:   codec,
+		codecs:  make(map[byte]CompressionCodec),
+		maxSize: maxSize,
+	}
+	for _, c := range []CompressionCodec{GzipCompression, FlateCompression,
+		codec} {
+
+		p.codecs[c.ID()] = c
+	}
+	return p
+}
+
+func (p compressedPersistent) Save() ([]byte, error) {
+	d, err := p.inner.Save()
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.codec.Compress(d)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, compressHeaderLen+len(c))
+	copy(b, compressMagic)
+	b[4] = p.codec.ID()
+	copy(b[compressHeaderLen:], c)
+	return b, nil
+}
+
+func (p compressedPersistent) Restore(b []byte) error {
+	if len(b) < compressHeaderLen || !bytes.Equal(b[:4], compressMagic) {
+		return p.inner.Restore(b)
+	}
+	codec, ok := p.codecs[b[4]]
+	if !ok {
+		return fmt.Errorf("raft: compression codec %d: %w", b[4],
+			ErrUnknownCompression)
+	}
+	d, err := codec.Decompress(b[compressHeaderLen:], p.maxSize)
+	if err == nil && int64(len(d)) > p.maxSize {
+		err = fmt.Errorf("raft: decompressed snapshot exceeds %d bytes",
+			p.maxSize)
+	}
+	if err != nil {
+		return fmt.Errorf(
+			"raft: cannot decompress snapshot of %d bytes with codec %d: %w: %w",
+			len(b), b[4], ErrSnapshotCorrupt, err)
+	}
+	return p.inner.Restore(d)
+}
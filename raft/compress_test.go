@@ -0,0 +1,102 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func newTestCompressibleStore() *MapStore {
+	s := NewMapStore()
+	for i := 0; i < 100; i++ {
+		s.Apply(SetCmd{Key: fmt.Sprintf("key-%d", i),
+			Val: bytes.Repeat([]byte("value"), 20)})
+	}
+	return s
+}
+
+func TestCompressedPersistent(t *testing.T) {
+	for _, codec := range []CompressionCodec{GzipCompression,
+		FlateCompression} {
+
+		src := newTestCompressibleStore()
+		raw, _ := src.Save()
+		b, err := CompressedPersistent(src, codec).Save()
+		if err != nil {
+			t.Fatalf("cannot save with codec %d: %v", codec.ID(), err)
+		}
+		if len(b) >= len(raw) {
+			t.Errorf("snapshot is not compressed by codec %d: %d >= %d",
+				codec.ID(), len(b), len(raw))
+		}
+
+		dst := NewMapStore()
+		if err := CompressedPersistent(dst, GzipCompression).Restore(b); err !=
+			nil {
+
+			t.Fatalf("cannot restore with codec %d: %v", codec.ID(), err)
+		}
+		d, _ := dst.Save()
+		if !bytes.Equal(d, raw) {
+			t.Errorf("invalid restored store with codec %d", codec.ID())
+		}
+	}
+}
+
+func TestCompressedPersistentUncompressed(t *testing.T) {
+	src := newTestCompressibleStore()
+	raw, err := src.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	dst := NewMapStore()
+	if err := CompressedPersistent(dst, FlateCompression).Restore(raw); err !=
+		nil {
+
+		t.Fatalf("cannot restore an uncompressed snapshot: %v", err)
+	}
+	if dst.Len() != src.Len() {
+		t.Errorf("invalid number of keys: actual=%d want=%d", dst.Len(),
+			src.Len())
+	}
+}
+
+func TestCompressedPersistentUnknownCodec(t *testing.T) {
+	b, _ := CompressedPersistent(NewMapStore(), GzipCompression).Save()
+	b[4] = 0xFF
+	err := CompressedPersistent(NewMapStore(), GzipCompression).Restore(b)
+	if !errors.Is(err, ErrUnknownCompression) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrUnknownCompression)
+	}
+}
+
+func TestCompressedPersistentMaxSize(t *testing.T) {
+	src := newTestCompressibleStore()
+	raw, _ := src.Save()
+	max := int64(len(raw))
+	for _, codec := range []CompressionCodec{GzipCompression,
+		FlateCompression} {
+
+		b, err := CompressedPersistent(src, codec).Save()
+		if err != nil {
+			t.Fatalf("cannot save: %v", err)
+		}
+		p := CompressedPersistentMaxSize(NewMapStore(), codec, max)
+		if err := p.Restore(b); err != nil {
+			t.Errorf("cannot restore a snapshot of the max size: %v", err)
+		}
+		p = CompressedPersistentMaxSize(NewMapStore(), codec, max-1)
+		if err := p.Restore(b); !errors.Is(err, ErrSnapshotCorrupt) {
+			t.Errorf("invalid error: actual=%v want=%v", err,
+				ErrSnapshotCorrupt)
+		}
+
+		bomb, _ := codec.Compress(make([]byte, 8<<20))
+		_, err = codec.Decompress(bomb, 1<<20)
+		if !errors.Is(err, ErrSnapshotCorrupt) {
+			t.Errorf("invalid error: actual=%v want=%v", err,
+				ErrSnapshotCorrupt)
+		}
+	}
+}
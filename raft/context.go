@@ -0,0 +1,110 @@
+package raft
+
+import (
+	"io"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// ContextPersistent is implemented by states whose Save and Restore can be
+// cancelled.
+type ContextPersistent interface {
+	// SaveContext saves the state into bytes, or returns ctx.Err() if ctx is
+	// done before the state is saved.
+	SaveContext(ctx context.Context) ([]byte, error)
+	// RestoreContext restores the state from b, or returns ctx.Err() if ctx is
+	// done before the state is restored.
+	RestoreContext(ctx context.Context, b []byte) error
+}
+
+// NewContextPersistent returns p as a ContextPersistent. If p does not
+// implement ContextPersistent, the returned value checks ctx before and after
+// calling p.Save and before calling p.Restore. Neither can be abandoned while
+// in progress: an abandoned Save would read the state while the caller goes
+// on modifying it, and an abandoned Restore would leave the state partially
+// restored.
+func NewContextPersistent(p Persistent) ContextPersistent {
+	if cp, ok := p.(ContextPersistent); ok {
+		return cp
+	}
+	return contextPersistent{p: p}
+}
+
+type contextPersistent struct {
+	p Persistent
+}
+
+func (c contextPersistent) SaveContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b, err := c.p.Save()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (c contextPersistent) RestoreContext(ctx context.Context,
+	b []byte) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.p.Restore(b)
+}
+
+// WriteSnapshotContext writes the snapshot of sp into w, and checks ctx before
+// each write to w.
+func WriteSnapshotContext(ctx context.Context, sp StreamingPersistent,
+	w io.Writer) error {
+
+	if err := sp.WriteSnapshot(ctxWriter{ctx: ctx, w: w}); err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadSnapshotContext restores sp from the snapshot read from r, and checks
+// ctx before each read from r.
+func ReadSnapshotContext(ctx context.Context, sp StreamingPersistent,
+	r io.Reader) error {
+
+	if err := sp.ReadSnapshot(ctxReader{ctx: ctx, r: r}); err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return nil
+}
+
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w ctxWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(b)
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
@@ -0,0 +1,112 @@
+package raft
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func TestContextPersistentCancelSave(t *testing.T) {
+	s := NewMapStore()
+	s.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	p := NewContextPersistent(testSlowPersistent{
+		StateMachine: s,
+		delay:        30 * time.Millisecond,
+	})
+	ctx, cnl := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cnl()
+
+	if _, err := p.SaveContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("invalid error: actual=%v want=%v", err,
+			context.DeadlineExceeded)
+	}
+	// Save must not be running anymore, hence this must not race with it.
+	for i := 0; i < 100; i++ {
+		s.Apply(SetCmd{Key: fmt.Sprint(i), Val: []byte("v")})
+	}
+}
+
+func TestContextPersistentRestore(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	b, err := NewContextPersistent(src).SaveContext(context.Background())
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	dst := NewMapStore()
+	ctx, cnl := context.WithCancel(context.Background())
+	cnl()
+	if err := NewContextPersistent(dst).RestoreContext(ctx, b); err !=
+		context.Canceled {
+
+		t.Errorf("invalid error: actual=%v want=%v", err, context.Canceled)
+	}
+	if dst.Len() != 0 {
+		t.Error("restored with a cancelled context")
+	}
+	err = NewContextPersistent(dst).RestoreContext(context.Background(), b)
+	if err != nil || dst.Len() != 1 {
+		t.Errorf("cannot restore: %v", err)
+	}
+}
+
+type testChunkedStream struct {
+	chunks int
+	delay  time.Duration
+}
+
+func (s testChunkedStream) WriteSnapshot(w io.Writer) error {
+	for i := 0; i < s.chunks; i++ {
+		time.Sleep(s.delay)
+		if _, err := w.Write([]byte{byte(i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s testChunkedStream) ReadSnapshot(r io.Reader) error {
+	b := make([]byte, 1)
+	for {
+		time.Sleep(s.delay)
+		if _, err := r.Read(b); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func TestSnapshotContextCancelStream(t *testing.T) {
+	s := testChunkedStream{chunks: 1000, delay: time.Millisecond}
+	ctx, cnl := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cnl()
+
+	var buf bytes.Buffer
+	err := WriteSnapshotContext(ctx, s, &buf)
+	if err != context.DeadlineExceeded {
+		t.Errorf("invalid error: actual=%v want=%v", err,
+			context.DeadlineExceeded)
+	}
+	if buf.Len() == 0 || buf.Len() == s.chunks {
+		t.Errorf("invalid number of written chunks: %d", buf.Len())
+	}
+
+	err = ReadSnapshotContext(ctx, s, bytes.NewReader(make([]byte, s.chunks)))
+	if err != context.DeadlineExceeded {
+		t.Errorf("invalid error: actual=%v want=%v", err,
+			context.DeadlineExceeded)
+	}
+
+	err = WriteSnapshotContext(context.Background(),
+		testChunkedStream{chunks: 3}, &buf)
+	if err != nil {
+		t.Errorf("cannot write snapshot: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package raft
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+)
+
+var (
+	// ErrOverflow is returned when a request would overflow a Counter.
+	ErrOverflow = errors.New("raft: counter overflow")
+)
+
+// IncrCmd increments a Counter by N.
+type IncrCmd struct {
+	N int64
+}
+
+// DecrCmd decrements a Counter by N.
+type DecrCmd struct {
+	N int64
+}
+
+// ValueCmd returns the value of a Counter.
+type ValueCmd struct{}
+
+// Counter is a state machine that holds a single int64. It accepts IncrCmd,
+// DecrCmd and ValueCmd requests, and responds with the value of the counter
+// after applying the request. Requests that would overflow the counter are
+// rejected with ErrOverflow. Counter is not safe for concurrent use.
+type Counter struct {
+	n int64
+}
+
+// Value returns the value of the counter.
+func (c *Counter) Value() int64 {
+	return c.n
+}
+
+// Reset sets the counter to 0.
+func (c *Counter) Reset() error {
+	c.n = 0
+	return nil
+}
+
+// Save saves the counter as 8 bytes in big endian.
+func (c *Counter) Save() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(c.n))
+	return b, nil
+}
+
+// Restore restores the counter from b.
+func (c *Counter) Restore(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("raft: counter snapshot of %d bytes, want 8: %w",
+			len(b), ErrSnapshotCorrupt)
+	}
+	c.n = int64(binary.BigEndian.Uint64(b))
+	return nil
+}
+
+// Clone returns a copy of the counter.
+func (c *Counter) Clone() StateMachine {
+	return &Counter{n: c.n}
+}
+
+// Fingerprint returns the snapshot of the counter, which is already canonical.
+func (c *Counter) Fingerprint() ([]byte, error) {
+	return c.Save()
+}
+
+// Apply applies an IncrCmd, DecrCmd or ValueCmd.
+func (c *Counter) Apply(req interface{}) (interface{}, error) {
+	switch r := req.(type) {
+	case IncrCmd:
+		if (r.N > 0 && c.n > math.MaxInt64-r.N) ||
+			(r.N < 0 && c.n < math.MinInt64-r.N) {
+
+			return c.n, ErrOverflow
+		}
+		c.n += r.N
+	case DecrCmd:
+		if (r.N > 0 && c.n < math.MinInt64+r.N) ||
+			(r.N < 0 && c.n > math.MaxInt64+r.N) {
+
+			return c.n, ErrOverflow
+		}
+		c.n -= r.N
+	case ValueCmd:
+	default:
+		return nil, fmt.Errorf("raft: counter request %#v: %w", req,
+			ErrUnknownCommand)
+	}
+	return c.n, nil
+}
+
+// Query serves a ValueCmd.
+func (c *Counter) Query(req interface{}) (interface{}, error) {
+	if _, ok := req.(ValueCmd); !ok {
+		return nil, fmt.Errorf("raft: counter query %#v: %w", req,
+			ErrUnknownCommand)
+	}
+	return c.n, nil
+}
+
+// ApplyConfChange is a no-op for Counter.
+func (c *Counter) ApplyConfChange(cc raftpb.ConfChange, gn GroupNode) error {
+	return nil
+}
+
+// ProcessStatusChange is a no-op for Counter.
+func (c *Counter) ProcessStatusChange(event interface{}) {}
+
+func init() {
+	gob.Register(IncrCmd{})
+	gob.Register(DecrCmd{})
+	gob.Register(ValueCmd{})
+	DefaultTypeRegistry.Register(IncrCmd{})
+	DefaultTypeRegistry.Register(DecrCmd{})
+	DefaultTypeRegistry.Register(ValueCmd{})
+}
@@ -0,0 +1,100 @@
+package raft
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	var c Counter
+	reqs := []struct {
+		req  interface{}
+		want int64
+	}{
+		{IncrCmd{N: 5}, 5},
+		{DecrCmd{N: 2}, 3},
+		{IncrCmd{N: -4}, -1},
+		{DecrCmd{N: -3}, 2},
+		{ValueCmd{}, 2},
+	}
+	for _, r := range reqs {
+		res, err := c.Apply(r.req)
+		if err != nil {
+			t.Fatalf("cannot apply %#v: %v", r.req, err)
+		}
+		if res.(int64) != r.want {
+			t.Errorf("invalid response for %#v: actual=%v want=%v", r.req, res,
+				r.want)
+		}
+	}
+	if _, err := c.Apply(SetCmd{}); err == nil {
+		t.Error("no error for an invalid request")
+	}
+}
+
+func TestCounterOverflow(t *testing.T) {
+	tests := []struct {
+		init int64
+		req  interface{}
+	}{
+		{math.MaxInt64, IncrCmd{N: 1}},
+		{math.MinInt64, IncrCmd{N: -1}},
+		{math.MinInt64, DecrCmd{N: 1}},
+		{math.MaxInt64, DecrCmd{N: -1}},
+		{0, DecrCmd{N: math.MinInt64}},
+		{-2, DecrCmd{N: math.MaxInt64}},
+	}
+	for _, test := range tests {
+		c := Counter{n: test.init}
+		if _, err := c.Apply(test.req); err != ErrOverflow {
+			t.Errorf("no overflow for %v and %#v: %v", test.init, test.req, err)
+		}
+		if c.n != test.init {
+			t.Errorf("counter changed on overflow: actual=%v want=%v", c.n,
+				test.init)
+		}
+	}
+
+	boundaries := []struct {
+		init int64
+		req  interface{}
+		want int64
+	}{
+		{math.MaxInt64 - 1, IncrCmd{N: 1}, math.MaxInt64},
+		{-1, DecrCmd{N: math.MaxInt64}, math.MinInt64},
+		{-1, DecrCmd{N: math.MinInt64}, math.MaxInt64},
+	}
+	for _, b := range boundaries {
+		c := Counter{n: b.init}
+		res, err := c.Apply(b.req)
+		if err != nil || res.(int64) != b.want {
+			t.Errorf("invalid response for %v and %#v: actual=%v,%v want=%v",
+				b.init, b.req, res, err, b.want)
+		}
+	}
+}
+
+func TestCounterSaveRestore(t *testing.T) {
+	for _, n := range []int64{0, 1, -1, math.MaxInt64, math.MinInt64} {
+		src := Counter{n: n}
+		b, err := src.Save()
+		if err != nil {
+			t.Fatalf("cannot save: %v", err)
+		}
+		var dst Counter
+		if err := dst.Restore(b); err != nil {
+			t.Fatalf("cannot restore: %v", err)
+		}
+		if dst.Value() != n {
+			t.Errorf("invalid restored value: actual=%v want=%v", dst.Value(), n)
+		}
+	}
+
+	c := Counter{n: 7}
+	if err := c.Restore([]byte{1, 2, 3}); err == nil {
+		t.Error("no error for an invalid snapshot")
+	}
+	if c.Value() != 7 {
+		t.Error("counter changed after a failed restore")
+	}
+}
@@ -0,0 +1,168 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+var deltaMagic = []byte("bhds")
+
+const (
+	deltaKindBase  byte = 0
+	deltaKindDelta byte = 1
+
+	deltaHeaderLen     = 4 + 1
+	deltaBaseHeaderLen = deltaHeaderLen + 8
+)
+
+// DeltaPersistent is implemented by states that can save incremental deltas
+// in addition to full snapshots.
+type DeltaPersistent interface {
+	Persistent
+	// SaveDelta returns the changes of the current state since base, which is a
+	// snapshot returned by Save.
+	SaveDelta(sinceBase []byte) ([]byte, error)
+	// ApplyDelta returns the full snapshot that results from applying delta,
+	// returned by SaveDelta, to base. It must not modify the current state.
+	ApplyDelta(base, delta []byte) ([]byte, error)
+}
+
+// DeltaManager is a Persistent that saves a base snapshot of its inner
+// Persistent, followed by deltas of the inner state since that base. A new base
+// is taken after maxDeltas deltas, or when a delta is larger than half of the
+// base. If the inner Persistent does not implement DeltaPersistent, all
+// snapshots are full snapshots.
+//
+// Raft keeps only the latest snapshot, hence each delta snapshot embeds its
+// base and can be restored on its own, for example after a restart or on a
+// follower that has never seen the base. Deltas avoid encoding the full state
+// on every save, and the policy above bounds a delta snapshot to one and a half
+// times the size of its base. Snapshots without a delta header are restored as
+// base snapshots.
+type DeltaManager struct {
+	inner     Persistent
+	maxDeltas int
+
+	mu     sync.Mutex
+	base   []byte
+	deltas int
+}
+
+// NewDeltaManager creates a DeltaManager that takes a new base snapshot of
+// inner after at most maxDeltas deltas. maxDeltas must not be negative.
+func NewDeltaManager(inner Persistent, maxDeltas int) *DeltaManager {
+	if maxDeltas < 0 {
+		panic("raft: max deltas must not be negative")
+	}
+	return &DeltaManager{
+		inner:     inner,
+		maxDeltas: maxDeltas,
+	}
+}
+
+// Save saves a delta since the current base, or a new base if the policy
+// requires so.
+func (m *DeltaManager) Save() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dp, ok := m.inner.(DeltaPersistent)
+	if ok && m.base != nil && m.deltas < m.maxDeltas {
+		d, err := dp.SaveDelta(m.base)
+		if err != nil {
+			return nil, err
+		}
+		if len(d) <= len(m.base)/2 {
+			m.deltas++
+			return deltaSnapshot(m.base, d), nil
+		}
+	}
+
+	b, err := m.inner.Save()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		m.base, m.deltas = b, 0
+	}
+	return baseSnapshot(b), nil
+}
+
+// Restore restores a base snapshot or a delta snapshot. The restored base is
+// used for the next deltas.
+func (m *DeltaManager) Restore(b []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(b) < deltaHeaderLen || !bytes.Equal(b[:4], deltaMagic) {
+		return m.restoreBase(b)
+	}
+	switch b[4] {
+	case deltaKindBase:
+		return m.restoreBase(b[deltaHeaderLen:])
+	case deltaKindDelta:
+		return m.restoreDelta(b)
+	}
+	return fmt.Errorf("raft: delta snapshot kind %d: %w", b[4],
+		ErrVersionMismatch)
+}
+
+func (m *DeltaManager) restoreBase(b []byte) error {
+	if err := m.inner.Restore(b); err != nil {
+		return err
+	}
+	if _, ok := m.inner.(DeltaPersistent); ok {
+		m.base, m.deltas = b, 0
+	}
+	return nil
+}
+
+func (m *DeltaManager) restoreDelta(b []byte) error {
+	if len(b) < deltaBaseHeaderLen {
+		return fmt.Errorf("raft: delta header needs %d bytes, got %d: %w",
+			deltaBaseHeaderLen, len(b), ErrSnapshotTooShort)
+	}
+	dp, ok := m.inner.(DeltaPersistent)
+	if !ok {
+		return fmt.Errorf("raft: %T does not support deltas: %w", m.inner,
+			ErrNotRecoverable)
+	}
+	n := binary.BigEndian.Uint64(b[deltaHeaderLen:deltaBaseHeaderLen])
+	if n > uint64(len(b)-deltaBaseHeaderLen) {
+		return fmt.Errorf("raft: delta base needs %d bytes, got %d: %w", n,
+			len(b)-deltaBaseHeaderLen, ErrSnapshotTooShort)
+	}
+	base := b[deltaBaseHeaderLen : deltaBaseHeaderLen+int(n)]
+	d := b[deltaBaseHeaderLen+int(n):]
+	full, err := dp.ApplyDelta(base, d)
+	if err != nil {
+		return fmt.Errorf("raft: cannot apply delta of %d bytes: %w", len(d),
+			err)
+	}
+	if err := m.inner.Restore(full); err != nil {
+		return err
+	}
+	m.base, m.deltas = base, 0
+	return nil
+}
+
+func baseSnapshot(b []byte) []byte {
+	s := make([]byte, deltaHeaderLen+len(b))
+	copy(s, deltaMagic)
+	s[4] = deltaKindBase
+	copy(s[deltaHeaderLen:], b)
+	return s
+}
+
+func deltaSnapshot(base, d []byte) []byte {
+	s := make([]byte, deltaBaseHeaderLen+len(base)+len(d))
+	copy(s, deltaMagic)
+	s[4] = deltaKindDelta
+	binary.BigEndian.PutUint64(s[deltaHeaderLen:deltaBaseHeaderLen],
+		uint64(len(base)))
+	copy(s[deltaBaseHeaderLen:], base)
+	copy(s[deltaBaseHeaderLen+len(base):], d)
+	return s
+}
@@ -0,0 +1,153 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDeltaManagerChain(t *testing.T) {
+	src := NewMapStore()
+	for i := 0; i < 100; i++ {
+		src.Apply(SetCmd{Key: fmt.Sprint(i), Val: bytes.Repeat([]byte{'v'}, 8)})
+	}
+	m := NewDeltaManager(src, 10)
+	var snaps [][]byte
+	for i := 0; i < 4; i++ {
+		b, err := m.Save()
+		if err != nil {
+			t.Fatalf("cannot save: %v", err)
+		}
+		if kind := b[4]; (i == 0) != (kind == deltaKindBase) {
+			t.Errorf("invalid kind of snapshot %d: %d", i, kind)
+		}
+		snaps = append(snaps, b)
+		src.Apply(SetCmd{Key: fmt.Sprint(i), Val: []byte("updated")})
+		src.Apply(DeleteCmd{Key: fmt.Sprint(50 + i)})
+		src.Apply(SetCmd{Key: fmt.Sprint("new", i), Val: []byte("new")})
+	}
+	b, err := m.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	snaps = append(snaps, b)
+
+	dst := NewMapStore()
+	dm := NewDeltaManager(dst, 10)
+	for i, b := range snaps {
+		if err := dm.Restore(b); err != nil {
+			t.Fatalf("cannot restore snapshot %d: %v", i, err)
+		}
+	}
+
+	want, _ := src.Save()
+	full := NewMapStore()
+	if err := full.Restore(want); err != nil {
+		t.Fatalf("cannot restore full snapshot: %v", err)
+	}
+	for _, sm := range []*MapStore{dst, full} {
+		if b, _ := sm.Save(); !bytes.Equal(b, want) {
+			t.Error("restored store is not identical to the source")
+		}
+	}
+}
+
+func TestDeltaManagerNewBase(t *testing.T) {
+	v := bytes.Repeat([]byte{'v'}, 100)
+	s := NewMapStore()
+	for i := 0; i < 10; i++ {
+		s.Apply(SetCmd{Key: fmt.Sprint(i), Val: v})
+	}
+	m := NewDeltaManager(s, 2)
+	kind := func() byte {
+		b, err := m.Save()
+		if err != nil {
+			t.Fatalf("cannot save: %v", err)
+		}
+		return b[4]
+	}
+
+	var got []byte
+	for i := 0; i < 4; i++ {
+		got = append(got, kind())
+	}
+	want := []byte{deltaKindBase, deltaKindDelta, deltaKindDelta, deltaKindBase}
+	if !bytes.Equal(got, want) {
+		t.Errorf("invalid snapshot kinds: actual=%v want=%v", got, want)
+	}
+
+	for i := 0; i < 10; i++ {
+		s.Apply(DeleteCmd{Key: fmt.Sprint(i)})
+		s.Apply(SetCmd{Key: fmt.Sprint("k", i), Val: v})
+	}
+	if kind() != deltaKindBase {
+		t.Error("no new base for a delta larger than the base")
+	}
+}
+
+func TestDeltaManagerFallback(t *testing.T) {
+	c := &Counter{}
+	c.Apply(IncrCmd{N: 3})
+	m := NewDeltaManager(c, 10)
+	for i := 0; i < 3; i++ {
+		b, err := m.Save()
+		if err != nil {
+			t.Fatalf("cannot save: %v", err)
+		}
+		if b[4] != deltaKindBase {
+			t.Errorf("delta for a store without delta support")
+		}
+	}
+
+	b, _ := c.Save()
+	dst := &Counter{}
+	if err := NewDeltaManager(dst, 10).Restore(b); err != nil {
+		t.Fatalf("cannot restore a snapshot without header: %v", err)
+	}
+	if dst.Value() != 3 {
+		t.Errorf("invalid value: actual=%d want=%d", dst.Value(), 3)
+	}
+}
+
+func TestDeltaManagerRestoreDelta(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "k", Val: []byte("value")})
+	src.Apply(SetCmd{Key: "large", Val: bytes.Repeat([]byte{'v'}, 1024)})
+	m := NewDeltaManager(src, 10)
+	m.Save()
+	src.Apply(SetCmd{Key: "k", Val: []byte("other")})
+	d, err := m.Save()
+	if err != nil || d[4] != deltaKindDelta {
+		t.Fatalf("cannot save a delta: %v", err)
+	}
+
+	// A fresh manager, as after a restart, has never seen the base.
+	dst := NewMapStore()
+	dm := NewDeltaManager(dst, 10)
+	if err := dm.Restore(d); err != nil {
+		t.Fatalf("cannot restore a delta in a fresh manager: %v", err)
+	}
+	want, _ := src.Save()
+	if b, _ := dst.Save(); !bytes.Equal(b, want) {
+		t.Error("restored store is not identical to the source")
+	}
+
+	dst.Apply(SetCmd{Key: "k", Val: []byte("again")})
+	d, err = dm.Save()
+	if err != nil || d[4] != deltaKindDelta {
+		t.Fatalf("cannot save a delta of the restored base: %v", err)
+	}
+	if err := NewDeltaManager(NewMapStore(), 10).Restore(d); err != nil {
+		t.Errorf("cannot restore a delta of the restored base: %v", err)
+	}
+
+	err = NewDeltaManager(NewMapStore(), 10).Restore(d[:deltaBaseHeaderLen+1])
+	if !errors.Is(err, ErrSnapshotTooShort) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrSnapshotTooShort)
+	}
+	err = NewDeltaManager(&Counter{}, 10).Restore(d)
+	if !errors.Is(err, ErrNotRecoverable) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNotRecoverable)
+	}
+}
@@ -0,0 +1,89 @@
+package raft
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Dispatcher applies requests by calling the handler registered for their
+// dynamic type. A state machine can embed a Dispatcher to implement Apply:
+//
+//	type store struct {
+//		raft.Dispatcher
+//		...
+//	}
+//
+//	s := &store{}
+//	s.Register(func(r SetCmd) error { ... })
+//	s.Register(func(r GetCmd) ([]byte, error) { ... })
+//
+// The zero value of Dispatcher has no handler and is ready to use.
+type Dispatcher struct {
+	mu       sync.RWMutex
+	handlers map[reflect.Type]reflect.Value
+}
+
+// Register registers the handler for the requests of type T. handler must be
+// a function of one of the following forms:
+//
+//	func(T) R
+//	func(T) error
+//	func(T) (R, error)
+//
+// Register panics if handler is not a valid function or if there is already a
+// handler for T.
+func (d *Dispatcher) Register(handler interface{}) {
+	h := reflect.ValueOf(handler)
+	if !h.IsValid() {
+		panic("raft: nil dispatcher handler")
+	}
+	t := h.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() > 2 ||
+		t.NumOut() == 0 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+
+		panic(fmt.Sprintf("raft: invalid dispatcher handler %v", t))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handlers == nil {
+		d.handlers = make(map[reflect.Type]reflect.Value)
+	}
+	rt := t.In(0)
+	if _, ok := d.handlers[rt]; ok {
+		panic(fmt.Sprintf("raft: handler for %v is already registered", rt))
+	}
+	d.handlers[rt] = h
+}
+
+// Apply calls the handler registered for the type of req and returns its
+// response.
+func (d *Dispatcher) Apply(req interface{}) (interface{}, error) {
+	d.mu.RLock()
+	h, ok := d.handlers[reflect.TypeOf(req)]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("raft: no handler for request of type %T: %w", req,
+			ErrUnknownCommand)
+	}
+
+	out := h.Call([]reflect.Value{reflect.ValueOf(req)})
+	switch {
+	case len(out) == 2:
+		return out[0].Interface(), toError(out[1])
+	case h.Type().Out(0) == errorType:
+		return nil, toError(out[0])
+	default:
+		return out[0].Interface(), nil
+	}
+}
+
+func toError(v reflect.Value) error {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Interface().(error)
+}
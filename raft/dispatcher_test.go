@@ -0,0 +1,80 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDispatcher(t *testing.T) {
+	m := make(map[string][]byte)
+	var d Dispatcher
+	d.Register(func(r SetCmd) error {
+		m[r.Key] = r.Val
+		return nil
+	})
+	d.Register(func(r GetCmd) ([]byte, error) {
+		v, ok := m[r.Key]
+		if !ok {
+			return nil, ErrNoSuchKey
+		}
+		return v, nil
+	})
+	d.Register(func(r DeleteCmd) bool {
+		_, ok := m[r.Key]
+		delete(m, r.Key)
+		return ok
+	})
+
+	if res, err := d.Apply(SetCmd{Key: "k", Val: []byte("v")}); res != nil ||
+		err != nil {
+
+		t.Errorf("invalid set result: actual=%v,%v want=nil,nil", res, err)
+	}
+	if res, err := d.Apply(GetCmd{Key: "k"}); err != nil ||
+		string(res.([]byte)) != "v" {
+
+		t.Errorf("invalid get result: actual=%q,%v want=%q", res, err, "v")
+	}
+	if _, err := d.Apply(GetCmd{Key: "none"}); err != ErrNoSuchKey {
+		t.Errorf("invalid get error: actual=%v want=%v", err, ErrNoSuchKey)
+	}
+	if res, err := d.Apply(DeleteCmd{Key: "k"}); err != nil || res != true {
+		t.Errorf("invalid delete result: actual=%v,%v want=true,nil", res, err)
+	}
+	if res, err := d.Apply(DeleteCmd{Key: "k"}); err != nil || res != false {
+		t.Errorf("invalid delete result: actual=%v,%v want=false,nil", res, err)
+	}
+}
+
+func TestDispatcherUnknownRequest(t *testing.T) {
+	var d Dispatcher
+	if _, err := d.Apply(SetCmd{}); err == nil {
+		t.Error("no error for a request without handler")
+	}
+	d.Register(func(r SetCmd) error { return errors.New("set") })
+	if _, err := d.Apply(&SetCmd{}); err == nil {
+		t.Error("no error for a pointer to a registered type")
+	}
+}
+
+func TestDispatcherInvalidHandler(t *testing.T) {
+	handlers := []interface{}{
+		nil,
+		"not a function",
+		func() error { return nil },
+		func(a, b SetCmd) error { return nil },
+		func(r SetCmd) {},
+		func(r SetCmd) (int, int) { return 0, 0 },
+	}
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for invalid handler %#v", h)
+				}
+			}()
+			var d Dispatcher
+			d.Register(h)
+		}()
+	}
+}
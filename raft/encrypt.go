@@ -0,0 +1,77 @@
+package raft
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrDecryptFailed is returned when a snapshot cannot be decrypted with any
+	// of the keys.
+	ErrDecryptFailed = newKindError("raft: cannot decrypt snapshot",
+		ErrNotRecoverable)
+)
+
+type encryptedPersistent struct {
+	inner Persistent
+	aeads []cipher.AEAD
+}
+
+// EncryptedPersistent returns a Persistent that encrypts the snapshots of
+// inner using AES-GCM. Save encrypts with key and a random nonce, which is
+// prepended to the snapshot. Restore authenticates and decrypts the snapshot
+// using key or any of the oldKeys, and returns ErrDecryptFailed if none of them
+// can open the snapshot. To rotate keys, pass the new key as key and the
+// previous ones as oldKeys until all snapshots are saved with the new key.
+//
+// Keys must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func EncryptedPersistent(inner Persistent, key []byte,
+	oldKeys ...[]byte) (Persistent, error) {
+
+	p := encryptedPersistent{inner: inner}
+	for _, k := range append([][]byte{key}, oldKeys...) {
+		b, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(b)
+		if err != nil {
+			return nil, err
+		}
+		p.aeads = append(p.aeads, aead)
+	}
+	return p, nil
+}
+
+func (p encryptedPersistent) Save() ([]byte, error) {
+	d, err := p.inner.Save()
+	if err != nil {
+		return nil, err
+	}
+	aead := p.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(d)+
+		aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, d, nil), nil
+}
+
+func (p encryptedPersistent) Restore(b []byte) error {
+	for _, aead := range p.aeads {
+		ns := aead.NonceSize()
+		if len(b) < ns+aead.Overhead() {
+			return fmt.Errorf("raft: encrypted snapshot of %d bytes: %w", len(b),
+				ErrSnapshotTooShort)
+		}
+		d, err := aead.Open(nil, b[:ns], b[ns:], nil)
+		if err != nil {
+			continue
+		}
+		return p.inner.Restore(d)
+	}
+	return ErrDecryptFailed
+}
@@ -0,0 +1,107 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func mustEncrypt(t *testing.T, p Persistent, key []byte,
+	oldKeys ...[]byte) Persistent {
+
+	ep, err := EncryptedPersistent(p, key, oldKeys...)
+	if err != nil {
+		t.Fatalf("cannot create encrypted persistent: %v", err)
+	}
+	return ep
+}
+
+func TestEncryptedPersistent(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "secret", Val: []byte("plaintext")})
+	raw, _ := src.Save()
+	b, err := mustEncrypt(t, src, testKey1).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if bytes.Contains(b, []byte("plaintext")) {
+		t.Error("snapshot is not encrypted")
+	}
+
+	dst := NewMapStore()
+	if err := mustEncrypt(t, dst, testKey1).Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if d, _ := dst.Save(); !bytes.Equal(d, raw) {
+		t.Error("invalid restored store")
+	}
+
+	b2, _ := mustEncrypt(t, src, testKey1).Save()
+	if bytes.Equal(b, b2) {
+		t.Error("nonce is reused")
+	}
+}
+
+func TestEncryptedPersistentWrongKey(t *testing.T) {
+	b, _ := mustEncrypt(t, NewMapStore(), testKey1).Save()
+	err := mustEncrypt(t, NewMapStore(), testKey2).Restore(b)
+	if err != ErrDecryptFailed {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrDecryptFailed)
+	}
+	if _, err := EncryptedPersistent(NewMapStore(), []byte("short")); err ==
+		nil {
+
+		t.Error("no error for an invalid key")
+	}
+}
+
+func TestEncryptedPersistentTamper(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	b, _ := mustEncrypt(t, src, testKey1).Save()
+	for _, i := range []int{0, len(b) / 2, len(b) - 1} {
+		c := append([]byte(nil), b...)
+		c[i] ^= 0x80
+		dst := NewMapStore()
+		if err := mustEncrypt(t, dst, testKey1).Restore(c); err !=
+			ErrDecryptFailed {
+
+			t.Errorf("tampered byte %d is not detected: %v", i, err)
+		}
+		if dst.Len() != 0 {
+			t.Error("tampered snapshot is restored")
+		}
+	}
+	err := mustEncrypt(t, src, testKey1).Restore(b[:4])
+	if !errors.Is(err, ErrSnapshotTooShort) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrSnapshotTooShort)
+	}
+}
+
+func TestEncryptedPersistentKeyRotation(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	old, _ := mustEncrypt(t, src, testKey1).Save()
+
+	rotated := mustEncrypt(t, NewMapStore(), testKey2, testKey1)
+	if err := rotated.Restore(old); err != nil {
+		t.Fatalf("cannot restore a snapshot encrypted with the old key: %v", err)
+	}
+	b, err := rotated.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if err := mustEncrypt(t, NewMapStore(), testKey1).Restore(b); err !=
+		ErrDecryptFailed {
+
+		t.Error("snapshot is not encrypted with the new key")
+	}
+	if err := mustEncrypt(t, NewMapStore(), testKey2).Restore(b); err != nil {
+		t.Errorf("cannot restore with the new key: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package raft
+
+import "errors"
+
+// Standard errors of the state machine helpers. More specific errors, such as
+// ErrChecksumMismatch or ErrUnknownVersion, match one of these using errors.Is,
+// so that callers can handle a class of failures regardless of the decorators
+// that produced them.
+var (
+	// ErrUnknownCommand is returned when a state machine cannot apply or query a
+	// request because of its type.
+	ErrUnknownCommand = errors.New("raft: unknown command")
+	// ErrSnapshotCorrupt is returned when a snapshot cannot be decoded or fails
+	// an integrity check.
+	ErrSnapshotCorrupt = errors.New("raft: corrupt snapshot")
+	// ErrVersionMismatch is returned when a snapshot is saved in a format, e.g.,
+	// a version, a checksum or a compression codec, that is not supported.
+	ErrVersionMismatch = errors.New("raft: snapshot version mismatch")
+	// ErrNotRecoverable is returned when a snapshot cannot be restored
+	// regardless of its contents, e.g., when the decryption keys are missing.
+	ErrNotRecoverable = errors.New("raft: snapshot is not recoverable")
+)
+
+// kindError is an error with its own message that also matches its kind, one
+// of the standard errors above, using errors.Is.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func newKindError(msg string, kind error) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
@@ -0,0 +1,131 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestUnknownCommandErrors(t *testing.T) {
+	d := &Dispatcher{}
+	d.Register(func(r SetCmd) error { return nil })
+
+	r := NewRegistry()
+	r.Register("m", NewMapStore())
+
+	sms := map[string]interface {
+		Apply(req interface{}) (interface{}, error)
+	}{
+		"map store":  NewMapStore(),
+		"counter":    &Counter{},
+		"dispatcher": d,
+		"typed":      Untyped[int64, int64](&testTypedCounter{}),
+		"registry":   r,
+	}
+	for name, sm := range sms {
+		if _, err := sm.Apply(struct{}{}); !errors.Is(err, ErrUnknownCommand) {
+			t.Errorf("invalid error for %v: actual=%v want=%v", name, err,
+				ErrUnknownCommand)
+		}
+	}
+
+	sm := NewIdempotent(SyncStateMachine(Chain(NewObservable(
+		LoggingStateMachine(NewMapStore(), ioutil.Discard)))), 1)
+	if _, err := sm.Apply(IncrCmd{N: 1}); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("invalid error for decorators: actual=%v want=%v", err,
+			ErrUnknownCommand)
+	}
+
+	_, err := r.Apply(NamespacedRequest{Namespace: "m", Data: IncrCmd{N: 1}})
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("invalid error for namespace: actual=%v want=%v", err,
+			ErrUnknownCommand)
+	}
+
+	for _, q := range []Querier{NewMapStore(), &Counter{}} {
+		if _, err := q.Query(SetCmd{}); !errors.Is(err, ErrUnknownCommand) {
+			t.Errorf("invalid error for %T query: actual=%v want=%v", q, err,
+				ErrUnknownCommand)
+		}
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+	newP := func() Persistent {
+		p := NewVersionedPersistent(ChecksumPersistent(NewMapStore()), 2)
+		return mustEncrypt(t, CompressedPersistent(p, GzipCompression), key)
+	}
+
+	tests := []struct {
+		name string
+		p    Persistent
+		b    []byte
+		want []error
+	}{
+		{
+			name: "checksum",
+			p:    ChecksumPersistent(NewMapStore()),
+			b:    []byte{checksumCRC32C, 0, 0, 0, 0, 1},
+			want: []error{ErrSnapshotCorrupt, ErrChecksumMismatch},
+		},
+		{
+			name: "too short",
+			p:    ChecksumPersistent(NewMapStore()),
+			b:    []byte{checksumCRC32C},
+			want: []error{ErrSnapshotCorrupt, ErrSnapshotTooShort},
+		},
+		{
+			name: "checksum version",
+			p:    ChecksumPersistent(NewMapStore()),
+			b:    []byte{checksumCRC32C + 1, 0, 0, 0, 0},
+			want: []error{ErrVersionMismatch, ErrUnknownChecksum},
+		},
+		{
+			name: "decode",
+			p:    NewVersionedPersistent(NewMapStore(), 1),
+			b:    append([]byte("bhsv\x00\x00\x00\x01"), "invalid"...),
+			want: []error{ErrSnapshotCorrupt},
+		},
+		{
+			name: "version",
+			p:    NewVersionedPersistent(NewMapStore(), 1),
+			b:    append([]byte("bhsv"), 0, 0, 0, 2),
+			want: []error{ErrVersionMismatch, ErrUnknownVersion},
+		},
+		{
+			name: "compression",
+			p:    CompressedPersistent(NewMapStore(), GzipCompression),
+			b:    append([]byte("bhzc"), FlateCompression.ID(), 0xFF, 0xFF),
+			want: []error{ErrSnapshotCorrupt},
+		},
+		{
+			name: "decrypt",
+			p:    newP(),
+			b:    bytes.Repeat([]byte{0}, 64),
+			want: []error{ErrNotRecoverable, ErrDecryptFailed},
+		},
+		{
+			name: "counter",
+			p:    WithPersistent(NewMapStore(), &Counter{}),
+			b:    []byte{1},
+			want: []error{ErrSnapshotCorrupt},
+		},
+		{
+			name: "not pointer",
+			p:    JSONPersistent(testState{}),
+			b:    []byte("{}"),
+			want: []error{ErrNotRecoverable, ErrNotPointer},
+		},
+	}
+	for _, test := range tests {
+		err := test.p.Restore(test.b)
+		for _, want := range test.want {
+			if !errors.Is(err, want) {
+				t.Errorf("invalid error for %v: actual=%v want=%v", test.name, err,
+					want)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package raft
+
+import "testing"
+
+func newFuzzPersistents() map[string]Persistent {
+	v := NewVersionedPersistent(&Counter{}, 2)
+	v.RegisterMigration(1, 2, func(b []byte) ([]byte, error) { return b, nil })
+
+	r := NewRegistry()
+	r.Register("m", NewMapStore())
+	r.Register("c", &Counter{})
+
+	return map[string]Persistent{
+		"map store":  NewMapStore(),
+		"counter":    &Counter{},
+		"checksum":   ChecksumPersistent(NewMapStore()),
+		"versioned":  v,
+		"compressed": CompressedPersistent(NewMapStore(), GzipCompression),
+		"delta":      NewDeltaManager(NewMapStore(), 4),
+		"registry":   r,
+	}
+}
+
+// FuzzRestore restores arbitrary bytes into stores and decorators, which must
+// return an error instead of panicking. Any snapshot that is restored must be
+// saved and restored again.
+func FuzzRestore(f *testing.F) {
+	s := NewMapStore()
+	s.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	c := &Counter{}
+	c.Apply(IncrCmd{N: 42})
+	for _, p := range []Persistent{
+		s,
+		c,
+		ChecksumPersistent(s),
+		NewVersionedPersistent(c, 1),
+		NewVersionedPersistent(c, 2),
+		CompressedPersistent(s, GzipCompression),
+		CompressedPersistent(s, FlateCompression),
+		NewDeltaManager(s, 4),
+	} {
+		b, err := p.Save()
+		if err != nil {
+			f.Fatalf("cannot save the seed corpus: %v", err)
+		}
+		f.Add(b)
+	}
+	f.Add([]byte{})
+	f.Add([]byte("bhsv\xff\xff\xff\xff"))
+	f.Add([]byte("bhzc\x01"))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for name, p := range newFuzzPersistents() {
+			if err := p.Restore(b); err != nil {
+				continue
+			}
+			saved, err := p.Save()
+			if err != nil {
+				t.Fatalf("%v cannot save a restored snapshot: %v", name, err)
+			}
+			if err := newFuzzPersistents()[name].Restore(saved); err != nil {
+				t.Fatalf("%v cannot restore its own snapshot: %v", name, err)
+			}
+		}
+	})
+}
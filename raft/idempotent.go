@@ -0,0 +1,219 @@
+package raft
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+
+	bhgob "github.com/kandoo/beehive/gob"
+)
+
+// IDCommand is implemented by requests that carry a unique ID. Requests with
+// the same ID are considered duplicates.
+type IDCommand interface {
+	// CommandID returns the unique ID of the request.
+	CommandID() string
+}
+
+type dedupEntry struct {
+	ID   string
+	Data interface{}
+	Err  error
+	// Kinds are the names of the sentinel errors wrapped by Err, saved so that
+	// they survive the snapshot.
+	Kinds []string
+}
+
+// dedupErrorKinds are the sentinel errors of this package that keep their
+// identity in the snapshots of IdempotentStateMachine. The names are stored in
+// the snapshots, hence they must never change. The order is fixed so that
+// saving the same state always results in the same bytes.
+var dedupErrorKinds = []struct {
+	name string
+	err  error
+}{
+	{"ErrUnknownCommand", ErrUnknownCommand},
+	{"ErrOverflow", ErrOverflow},
+	{"ErrNoSuchKey", ErrNoSuchKey},
+	{"ErrNoSuchNamespace", ErrNoSuchNamespace},
+	{"ErrNamespaceExists", ErrNamespaceExists},
+	{"ErrUnregisteredType", ErrUnregisteredType},
+	{"ErrNotResettable", ErrNotResettable},
+}
+
+// dedupError is a restored error that wraps the sentinel errors of the
+// original one.
+type dedupError struct {
+	msg   string
+	kinds []error
+}
+
+func (e dedupError) Error() string   { return e.msg }
+func (e dedupError) Unwrap() []error { return e.kinds }
+
+func saveDedupError(e *dedupEntry) {
+	for _, k := range dedupErrorKinds {
+		if errors.Is(e.Err, k.err) {
+			e.Kinds = append(e.Kinds, k.name)
+		}
+	}
+	e.Err = bhgob.NewError(e.Err)
+}
+
+func restoreDedupError(e *dedupEntry) {
+	var kinds []error
+	for _, name := range e.Kinds {
+		for _, k := range dedupErrorKinds {
+			if k.name == name {
+				kinds = append(kinds, k.err)
+			}
+		}
+	}
+	if len(kinds) != 0 {
+		e.Err = dedupError{msg: e.Err.Error(), kinds: kinds}
+	}
+	e.Kinds = nil
+}
+
+type dedupSnapshot struct {
+	Inner   []byte
+	Entries []dedupEntry
+}
+
+// IdempotentStateMachine is a state machine that applies each IDCommand at
+// most once. It remembers the responses of the last applied IDCommands, and
+// returns the remembered response when a duplicate is applied. Requests that
+// do not implement IDCommand are always applied.
+//
+// The number of remembered responses is bounded by size, and the oldest
+// response is forgotten first. Responses are not forgotten based on time,
+// since wall-clock time differs among the replicas of a state machine.
+//
+// The remembered responses are included in the snapshots. Their data must be
+// registered using gob.Register. Their errors keep their messages, and still
+// match the sentinel errors of this package they wrap, such as ErrOverflow,
+// using errors.Is. Any other error identity is lost: such errors are restored
+// as github.com/kandoo/beehive/gob.Error.
+type IdempotentStateMachine struct {
+	StateMachine
+
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	cache map[string]*list.Element
+}
+
+// NewIdempotent returns an IdempotentStateMachine that applies requests using
+// sm and remembers the responses of the last size IDCommands.
+func NewIdempotent(sm StateMachine, size int) *IdempotentStateMachine {
+	if size <= 0 {
+		panic("raft: dedup cache size must be positive")
+	}
+	return &IdempotentStateMachine{
+		StateMachine: sm,
+		size:         size,
+		order:        list.New(),
+		cache:        make(map[string]*list.Element),
+	}
+}
+
+// Apply applies req unless it is a duplicate IDCommand.
+func (s *IdempotentStateMachine) Apply(req interface{}) (interface{}, error) {
+	idc, ok := req.(IDCommand)
+	if !ok {
+		return s.StateMachine.Apply(req)
+	}
+
+	id := idc.CommandID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.cache[id]; ok {
+		e := el.Value.(dedupEntry)
+		return e.Data, e.Err
+	}
+	res, err := s.StateMachine.Apply(req)
+	s.remember(dedupEntry{ID: id, Data: res, Err: err})
+	return res, err
+}
+
+func (s *IdempotentStateMachine) remember(e dedupEntry) {
+	s.cache[e.ID] = s.order.PushBack(e)
+	for s.order.Len() > s.size {
+		oldest := s.order.Front()
+		delete(s.cache, oldest.Value.(dedupEntry).ID)
+		s.order.Remove(oldest)
+	}
+}
+
+// Reset resets the inner state machine and forgets all remembered responses.
+func (s *IdempotentStateMachine) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := Reset(s.StateMachine); err != nil {
+		return err
+	}
+	s.order.Init()
+	s.cache = make(map[string]*list.Element)
+	return nil
+}
+
+// Len returns the number of remembered responses.
+func (s *IdempotentStateMachine) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// Save saves the inner state machine along with the remembered responses. Both
+// are saved under the same lock as Apply, so that the snapshot never remembers
+// a response whose request is not applied in the inner snapshot.
+func (s *IdempotentStateMachine) Save() ([]byte, error) {
+	s.mu.Lock()
+	d, err := s.StateMachine.Save()
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	snap := dedupSnapshot{Inner: d}
+	for el := s.order.Front(); el != nil; el = el.Next() {
+		e := el.Value.(dedupEntry)
+		if e.Err != nil {
+			saveDedupError(&e)
+		}
+		snap.Entries = append(snap.Entries, e)
+	}
+	s.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Restore restores the inner state machine and the remembered responses.
+func (s *IdempotentStateMachine) Restore(b []byte) error {
+	var snap dedupSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&snap); err != nil {
+		return fmt.Errorf("raft: cannot decode dedup snapshot of %d bytes: %w: %w",
+			len(b), ErrSnapshotCorrupt, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.StateMachine.Restore(snap.Inner); err != nil {
+		return err
+	}
+	s.order.Init()
+	s.cache = make(map[string]*list.Element)
+	for _, e := range snap.Entries {
+		if e.Err != nil {
+			restoreDedupError(&e)
+		}
+		s.remember(e)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package raft
+
+import (
+	"encoding/gob"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+type testIncrOnce struct {
+	ID string
+	N  int64
+}
+
+func (c testIncrOnce) CommandID() string { return c.ID }
+
+type testIdempotentCounter struct {
+	Counter
+}
+
+func (c *testIdempotentCounter) Apply(req interface{}) (interface{}, error) {
+	if r, ok := req.(testIncrOnce); ok {
+		req = IncrCmd{N: r.N}
+	}
+	return c.Counter.Apply(req)
+}
+
+func TestIdempotentStateMachine(t *testing.T) {
+	c := &testIdempotentCounter{}
+	s := NewIdempotent(c, 2)
+	reqs := []struct {
+		req  interface{}
+		want int64
+	}{
+		{testIncrOnce{ID: "a", N: 1}, 1},
+		{testIncrOnce{ID: "a", N: 1}, 1},
+		{testIncrOnce{ID: "b", N: 2}, 3},
+		{testIncrOnce{ID: "b", N: 2}, 3},
+		{IncrCmd{N: 1}, 4},
+		{IncrCmd{N: 1}, 5},
+		{testIncrOnce{ID: "c", N: 10}, 15},
+		// "a" is evicted by "c".
+		{testIncrOnce{ID: "a", N: 1}, 16},
+		{testIncrOnce{ID: "c", N: 10}, 15},
+	}
+	for i, r := range reqs {
+		res, err := s.Apply(r.req)
+		if err != nil || res.(int64) != r.want {
+			t.Errorf("invalid response %d: actual=%v,%v want=%v", i, res, err,
+				r.want)
+		}
+	}
+	if s.Len() != 2 {
+		t.Errorf("invalid cache size: actual=%d want=%d", s.Len(), 2)
+	}
+}
+
+func TestIdempotentStateMachineSaveRestore(t *testing.T) {
+	gob.Register(testIncrOnce{})
+
+	src := NewIdempotent(&testIdempotentCounter{}, 10)
+	src.Apply(testIncrOnce{ID: "a", N: 5})
+	src.Apply(testIncrOnce{ID: "b", N: 7})
+	src.Apply(DecrCmd{N: -1})
+	b, err := src.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	c := &testIdempotentCounter{}
+	dst := NewIdempotent(c, 10)
+	if err := dst.Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if c.Value() != 13 {
+		t.Errorf("invalid restored counter: actual=%d want=%d", c.Value(), 13)
+	}
+	res, err := dst.Apply(testIncrOnce{ID: "a", N: 5})
+	if err != nil || res.(int64) != 5 {
+		t.Errorf("duplicate after restore is applied: actual=%v,%v want=%v", res,
+			err, 5)
+	}
+	if c.Value() != 13 {
+		t.Errorf("duplicate changed the counter: %d", c.Value())
+	}
+}
+
+func TestIdempotentStateMachineSaveDuringApply(t *testing.T) {
+	gob.Register(testIncrOnce{})
+
+	src := NewIdempotent(testSlowPersistent{
+		StateMachine: &testIdempotentCounter{},
+		delay:        50 * time.Millisecond,
+	}, 10)
+	type saveResult struct {
+		b   []byte
+		err error
+	}
+	ch := make(chan saveResult)
+	go func() {
+		b, err := src.Save()
+		ch <- saveResult{b: b, err: err}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	src.Apply(testIncrOnce{ID: "a", N: 1})
+	res := <-ch
+	if res.err != nil {
+		t.Fatalf("cannot save: %v", res.err)
+	}
+
+	c := &testIdempotentCounter{}
+	dst := NewIdempotent(c, 10)
+	if err := dst.Restore(res.b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	// The retry must be applied unless its effect is in the snapshot.
+	dst.Apply(testIncrOnce{ID: "a", N: 1})
+	if c.Value() != 1 {
+		t.Errorf("invalid counter after retry: actual=%d want=%d", c.Value(), 1)
+	}
+}
+
+type testUnknownOnce struct {
+	ID string
+}
+
+func (c testUnknownOnce) CommandID() string { return c.ID }
+
+func TestIdempotentStateMachineRestoreErrors(t *testing.T) {
+	gob.Register(testIncrOnce{})
+	gob.Register(testUnknownOnce{})
+
+	reqs := []struct {
+		req  interface{}
+		want error
+	}{
+		{testIncrOnce{ID: "a", N: math.MaxInt64}, nil},
+		{testIncrOnce{ID: "b", N: 1}, ErrOverflow},
+		{testUnknownOnce{ID: "c"}, ErrUnknownCommand},
+	}
+	src := NewIdempotent(&testIdempotentCounter{}, 10)
+	for _, r := range reqs {
+		src.Apply(r.req)
+	}
+	b, err := src.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	dst := NewIdempotent(&testIdempotentCounter{}, 10)
+	if err := dst.Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	for _, r := range reqs {
+		_, want := src.Apply(r.req)
+		_, err := dst.Apply(r.req)
+		if !errors.Is(err, r.want) || !errors.Is(want, r.want) {
+			t.Errorf("invalid error for %#v: actual=%v want=%v", r.req, err,
+				r.want)
+		}
+		if (err == nil) != (want == nil) ||
+			(err != nil && err.Error() != want.Error()) {
+
+			t.Errorf("invalid error message: actual=%v want=%v", err, want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+)
+
+var (
+	// ErrNoSuchKey is returned when a MapStore does not have the requested key.
+	ErrNoSuchKey = errors.New("raft: no such key")
+)
+
+// SetCmd sets the value of Key to Val in a MapStore.
+type SetCmd struct {
+	Key string
+	Val []byte
+}
+
+// GetCmd retrieves the value of Key from a MapStore.
+type GetCmd struct {
+	Key string
+}
+
+// DeleteCmd deletes Key from a MapStore.
+type DeleteCmd struct {
+	Key string
+}
+
+// MapStore is an in-memory key-value state machine. It accepts SetCmd, GetCmd
+// and DeleteCmd requests. Values are copied in and out of the store, hence
+// callers may modify the slices they pass in SetCmd and get from GetCmd.
+// MapStore is not safe for concurrent use, but its snapshots can be persisted
+// concurrently with Apply.
+type MapStore struct {
+	m map[string][]byte
+}
+
+// NewMapStore creates an empty MapStore.
+func NewMapStore() *MapStore {
+	return &MapStore{
+		m: make(map[string][]byte),
+	}
+}
+
+// Save encodes the map using gob. Entries are sorted by key, hence saving the
+// same map always results in the same bytes.
+func (s *MapStore) Save() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.WriteSnapshot(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Restore replaces the map with the one encoded in b.
+func (s *MapStore) Restore(b []byte) error {
+	return s.ReadSnapshot(bytes.NewReader(b))
+}
+
+// WriteSnapshot encodes the map into w using gob. Entries are encoded one at a
+// time, after their count, hence the snapshot is never buffered as a whole.
+func (s *MapStore) WriteSnapshot(w io.Writer) error {
+	return writeMapSnapshot(w, s.m)
+}
+
+// ReadSnapshot replaces the map with the one decoded from r.
+func (s *MapStore) ReadSnapshot(r io.Reader) error {
+	m, err := decodeMapSnapshot(r)
+	if err != nil {
+		return err
+	}
+	s.m = m
+	return nil
+}
+
+type mapEntry struct {
+	Key string
+	Val []byte
+}
+
+func writeMapSnapshot(w io.Writer, m map[string][]byte) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(uint64(len(keys))); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := enc.Encode(mapEntry{Key: k, Val: m[k]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readMapSnapshot(b []byte) (map[string][]byte, error) {
+	return decodeMapSnapshot(bytes.NewReader(b))
+}
+
+func decodeMapSnapshot(r io.Reader) (map[string][]byte, error) {
+	dec := gob.NewDecoder(r)
+	var n uint64
+	if err := dec.Decode(&n); err != nil {
+		return nil, fmt.Errorf("raft: cannot decode map store snapshot: %w: %w",
+			ErrSnapshotCorrupt, err)
+	}
+	// n is not trusted for preallocation, since the snapshot may be corrupt.
+	m := make(map[string][]byte)
+	for i := uint64(0); i < n; i++ {
+		var e mapEntry
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf(
+				"raft: cannot decode map store entry %d of %d: %w: %w", i, n,
+				ErrSnapshotCorrupt, err)
+		}
+		m[e.Key] = e.Val
+	}
+	return m, nil
+}
+
+// mapDelta is the set of keys set and deleted since a base snapshot.
+type mapDelta struct {
+	Set []mapEntry
+	Del []string
+}
+
+// SaveDelta returns the keys set and deleted since base.
+func (s *MapStore) SaveDelta(sinceBase []byte) ([]byte, error) {
+	base, err := readMapSnapshot(sinceBase)
+	if err != nil {
+		return nil, err
+	}
+	var d mapDelta
+	for k, v := range s.m {
+		if bv, ok := base[k]; !ok || !bytes.Equal(bv, v) {
+			d.Set = append(d.Set, mapEntry{Key: k, Val: v})
+		}
+	}
+	for k := range base {
+		if _, ok := s.m[k]; !ok {
+			d.Del = append(d.Del, k)
+		}
+	}
+	sort.Slice(d.Set, func(i, j int) bool {
+		return d.Set[i].Key < d.Set[j].Key
+	})
+	sort.Strings(d.Del)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ApplyDelta returns the snapshot of base after applying delta.
+func (s *MapStore) ApplyDelta(base, delta []byte) ([]byte, error) {
+	m, err := readMapSnapshot(base)
+	if err != nil {
+		return nil, err
+	}
+	var d mapDelta
+	if err := gob.NewDecoder(bytes.NewReader(delta)).Decode(&d); err != nil {
+		return nil, fmt.Errorf("raft: cannot decode map store delta: %w: %w",
+			ErrSnapshotCorrupt, err)
+	}
+	for _, e := range d.Set {
+		m[e.Key] = e.Val
+	}
+	for _, k := range d.Del {
+		delete(m, k)
+	}
+	var buf bytes.Buffer
+	if err := writeMapSnapshot(&buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Snapshot returns a snapshot of the map that is not affected by the requests
+// applied afterwards.
+func (s *MapStore) Snapshot() (Snapshot, error) {
+	return &mapSnapshot{m: s.copyMap()}, nil
+}
+
+// Clone returns a copy of the store. Values are shared between the copies,
+// since the store never modifies them in place nor exposes them to callers.
+func (s *MapStore) Clone() StateMachine {
+	return &MapStore{m: s.copyMap()}
+}
+
+func (s *MapStore) copyMap() map[string][]byte {
+	m := make(map[string][]byte, len(s.m))
+	for k, v := range s.m {
+		m[k] = v
+	}
+	return m
+}
+
+type mapSnapshot struct {
+	m map[string][]byte
+}
+
+func (s *mapSnapshot) Persist(w io.Writer) error {
+	return writeMapSnapshot(w, s.m)
+}
+
+func (s *mapSnapshot) Release() {
+	s.m = nil
+}
+
+// Apply applies a SetCmd, GetCmd or DeleteCmd. GetCmd returns the value of
+// the key, or ErrNoSuchKey if the key does not exist.
+func (s *MapStore) Apply(req interface{}) (interface{}, error) {
+	switch r := req.(type) {
+	case SetCmd:
+		s.m[r.Key] = append([]byte(nil), r.Val...)
+		return nil, nil
+	case GetCmd:
+		v, ok := s.m[r.Key]
+		if !ok {
+			return nil, ErrNoSuchKey
+		}
+		return append([]byte(nil), v...), nil
+	case DeleteCmd:
+		delete(s.m, r.Key)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("raft: map store request %#v: %w", req,
+		ErrUnknownCommand)
+}
+
+// Fingerprint returns the SHA-256 hash of the sorted key-value pairs.
+func (s *MapStore) Fingerprint() ([]byte, error) {
+	keys := make([]string, 0, len(s.m))
+	for k := range s.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	var l [8]byte
+	for _, k := range keys {
+		v := s.m[k]
+		binary.BigEndian.PutUint64(l[:], uint64(len(k)))
+		h.Write(l[:])
+		h.Write([]byte(k))
+		binary.BigEndian.PutUint64(l[:], uint64(len(v)))
+		h.Write(l[:])
+		h.Write(v)
+	}
+	return h.Sum(nil), nil
+}
+
+// Query serves a GetCmd without modifying the store. Other requests are
+// rejected.
+func (s *MapStore) Query(req interface{}) (interface{}, error) {
+	if _, ok := req.(GetCmd); !ok {
+		return nil, fmt.Errorf("raft: map store query %#v: %w", req,
+			ErrUnknownCommand)
+	}
+	return s.Apply(req)
+}
+
+// ApplyConfChange is a no-op for MapStore.
+func (s *MapStore) ApplyConfChange(cc raftpb.ConfChange, gn GroupNode) error {
+	return nil
+}
+
+// ProcessStatusChange is a no-op for MapStore.
+func (s *MapStore) ProcessStatusChange(event interface{}) {}
+
+// Reset removes all keys from the store.
+func (s *MapStore) Reset() error {
+	s.m = make(map[string][]byte)
+	return nil
+}
+
+// Len returns the number of keys in the store.
+func (s *MapStore) Len() int {
+	return len(s.m)
+}
+
+func init() {
+	gob.Register(SetCmd{})
+	gob.Register(GetCmd{})
+	gob.Register(DeleteCmd{})
+	DefaultTypeRegistry.Register(SetCmd{})
+	DefaultTypeRegistry.Register(GetCmd{})
+	DefaultTypeRegistry.Register(DeleteCmd{})
+}
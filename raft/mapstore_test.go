@@ -0,0 +1,166 @@
+package raft
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestMapStoreApply(t *testing.T) {
+	s := NewMapStore()
+	if _, err := s.Apply(SetCmd{Key: "k", Val: []byte("v")}); err != nil {
+		t.Fatalf("cannot set: %v", err)
+	}
+	v, err := s.Apply(GetCmd{Key: "k"})
+	if err != nil {
+		t.Fatalf("cannot get: %v", err)
+	}
+	if !bytes.Equal(v.([]byte), []byte("v")) {
+		t.Errorf("invalid value: actual=%q want=%q", v, "v")
+	}
+	if _, err = s.Apply(DeleteCmd{Key: "k"}); err != nil {
+		t.Fatalf("cannot delete: %v", err)
+	}
+	if _, err = s.Apply(GetCmd{Key: "k"}); err != ErrNoSuchKey {
+		t.Errorf("invalid error for deleted key: actual=%v want=%v", err,
+			ErrNoSuchKey)
+	}
+	if _, err = s.Apply("invalid"); err == nil {
+		t.Error("no error for an invalid request")
+	}
+}
+
+func TestMapStoreApplyCopiesValues(t *testing.T) {
+	s := NewMapStore()
+	val := []byte("v")
+	if _, err := s.Apply(SetCmd{Key: "k", Val: val}); err != nil {
+		t.Fatalf("cannot set: %v", err)
+	}
+	val[0] = 'x'
+	v, err := s.Apply(GetCmd{Key: "k"})
+	if err != nil {
+		t.Fatalf("cannot get: %v", err)
+	}
+	v.([]byte)[0] = 'y'
+	c := s.Clone()
+	for _, sm := range []StateMachine{s, c} {
+		v, err = sm.Apply(GetCmd{Key: "k"})
+		if err != nil {
+			t.Fatalf("cannot get: %v", err)
+		}
+		if !bytes.Equal(v.([]byte), []byte("v")) {
+			t.Errorf("invalid value: actual=%q want=%q", v, "v")
+		}
+	}
+}
+
+func TestMapStoreSaveRestore(t *testing.T) {
+	src := NewMapStore()
+	for _, k := range []string{"a", "b", "c"} {
+		src.Apply(SetCmd{Key: k, Val: []byte(k + k)})
+	}
+	src.Apply(DeleteCmd{Key: "b"})
+
+	b, err := src.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	dst := NewMapStore()
+	dst.Apply(SetCmd{Key: "stale", Val: []byte("stale")})
+	if err = dst.Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if dst.Len() != 2 {
+		t.Errorf("invalid number of keys: actual=%d want=%d", dst.Len(), 2)
+	}
+	for _, k := range []string{"a", "c"} {
+		v, err := dst.Apply(GetCmd{Key: k})
+		if err != nil {
+			t.Errorf("cannot get %v: %v", k, err)
+			continue
+		}
+		if !bytes.Equal(v.([]byte), []byte(k+k)) {
+			t.Errorf("invalid value for %v: actual=%q want=%q", k, v, k+k)
+		}
+	}
+	for _, k := range []string{"b", "stale"} {
+		if _, err := dst.Apply(GetCmd{Key: k}); err != ErrNoSuchKey {
+			t.Errorf("key %v is restored", k)
+		}
+	}
+}
+
+func TestMapStoreRestoreInvalid(t *testing.T) {
+	s := NewMapStore()
+	s.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	if err := s.Restore([]byte("invalid")); err == nil {
+		t.Fatal("no error for invalid snapshot")
+	}
+	if s.Len() != 1 {
+		t.Errorf("store changed after a failed restore")
+	}
+}
+
+func TestMapStoreSaveDeterministic(t *testing.T) {
+	s := NewMapStore()
+	for i := 0; i < 100; i++ {
+		k := string(rune('a' + i%26))
+		s.Apply(SetCmd{Key: k + k, Val: []byte(k)})
+	}
+	want, err := s.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		b, err := s.Save()
+		if err != nil {
+			t.Fatalf("cannot save: %v", err)
+		}
+		if !bytes.Equal(b, want) {
+			t.Fatal("saving the same map results in different bytes")
+		}
+	}
+}
+
+// testCountingWriter counts the writes and the size of the largest one.
+type testCountingWriter struct {
+	writes int
+	max    int
+}
+
+func (w *testCountingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	if len(b) > w.max {
+		w.max = len(b)
+	}
+	return len(b), nil
+}
+
+func TestMapStoreWriteSnapshotStreams(t *testing.T) {
+	s := NewMapStore()
+	v := bytes.Repeat([]byte{'v'}, 1024)
+	for i := 0; i < 100; i++ {
+		s.Apply(SetCmd{Key: fmt.Sprint(i), Val: v})
+	}
+	var w testCountingWriter
+	if err := s.WriteSnapshot(&w); err != nil {
+		t.Fatalf("cannot write snapshot: %v", err)
+	}
+	if w.writes < 100 {
+		t.Errorf("invalid number of writes: actual=%d want>=100", w.writes)
+	}
+	if w.max > 2*len(v) {
+		t.Errorf("invalid largest write: actual=%d want<=%d", w.max, 2*len(v))
+	}
+
+	var buf bytes.Buffer
+	s.WriteSnapshot(&buf)
+	dst := NewMapStore()
+	if err := dst.ReadSnapshot(&buf); err != nil {
+		t.Fatalf("cannot read snapshot: %v", err)
+	}
+	if dst.Len() != 100 {
+		t.Errorf("invalid store length: actual=%d want=100", dst.Len())
+	}
+}
@@ -0,0 +1,175 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDropped is returned when MemTransport drops a request or its response.
+	ErrDropped = errors.New("raft: message dropped")
+)
+
+type memResult struct {
+	res interface{}
+	err error
+	// unapplied is set when the peer is unregistered before applying the
+	// request.
+	unapplied bool
+}
+
+type memMessage struct {
+	req interface{}
+	res chan memResult
+}
+
+type memPeer struct {
+	inbox chan memMessage
+	done  chan struct{}
+}
+
+// MemTransport is an in-memory Transport for tests. It delivers requests to
+// the state machines registered in the same process, without serializing
+// them. Each peer applies its requests sequentially, in the order they are
+// received, hence its state machine does not need to be safe for concurrent
+// use.
+//
+// For fault testing, MemTransport can delay messages and drop them at random.
+// Both requests and responses can be dropped, so a Send that returns
+// ErrDropped may or may not have been applied by the peer.
+type MemTransport struct {
+	mu       sync.RWMutex
+	peers    map[string]*memPeer
+	latency  time.Duration
+	dropRate float64
+}
+
+// NewMemTransport creates a MemTransport without latency and message loss.
+func NewMemTransport() *MemTransport {
+	return &MemTransport{
+		peers: make(map[string]*memPeer),
+	}
+}
+
+// Register registers sm as the state machine of peer, replacing the previous
+// one if any.
+func (t *MemTransport) Register(peer string, sm StateMachine) {
+	p := &memPeer{
+		inbox: make(chan memMessage),
+		done:  make(chan struct{}),
+	}
+	go p.serve(sm)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.peers[peer]; ok {
+		close(old.done)
+	}
+	t.peers[peer] = p
+}
+
+// Unregister removes peer from the transport. Requests to peer that are not
+// applied yet fail with ErrNoSuchPeer and are never applied. A request that
+// peer has already started to apply is completed, and its response is
+// returned.
+func (t *MemTransport) Unregister(peer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.peers[peer]; ok {
+		close(p.done)
+		delete(t.peers, peer)
+	}
+}
+
+// SetLatency sets the delay of each request and each response. Hence, a Send
+// takes at least twice as long as d.
+func (t *MemTransport) SetLatency(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latency = d
+}
+
+// SetDropRate sets the probability of dropping each request and each
+// response. rate must be in [0, 1].
+func (t *MemTransport) SetDropRate(rate float64) {
+	if rate < 0 || rate > 1 {
+		panic(fmt.Sprintf("raft: invalid drop rate %v", rate))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dropRate = rate
+}
+
+// Send applies req on the state machine registered for peer.
+func (t *MemTransport) Send(peer string, req interface{}) (interface{},
+	error) {
+
+	t.mu.RLock()
+	p, ok := t.peers[peer]
+	latency, rate := t.latency, t.dropRate
+	t.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("raft: peer %q: %w", peer, ErrNoSuchPeer)
+	}
+
+	if err := deliver(latency, rate); err != nil {
+		return nil, fmt.Errorf("raft: request to %q: %w", peer, err)
+	}
+	m := memMessage{req: req, res: make(chan memResult, 1)}
+	select {
+	case p.inbox <- m:
+	case <-p.done:
+		return nil, fmt.Errorf("raft: peer %q: %w", peer, ErrNoSuchPeer)
+	}
+	r := <-m.res
+	if r.unapplied {
+		return nil, fmt.Errorf("raft: peer %q: %w", peer, ErrNoSuchPeer)
+	}
+	if err := deliver(latency, rate); err != nil {
+		return nil, fmt.Errorf("raft: response from %q: %w", peer, err)
+	}
+	return r.res, r.err
+}
+
+// Close unregisters all peers.
+func (t *MemTransport) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for peer, p := range t.peers {
+		close(p.done)
+		delete(t.peers, peer)
+	}
+}
+
+func deliver(latency time.Duration, dropRate float64) error {
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if dropRate > 0 && rand.Float64() < dropRate {
+		return ErrDropped
+	}
+	return nil
+}
+
+func (p *memPeer) serve(sm StateMachine) {
+	for {
+		select {
+		case m := <-p.inbox:
+			// Both cases can be ready at the same time, in which case select
+			// chooses randomly.
+			select {
+			case <-p.done:
+				m.res <- memResult{unapplied: true}
+				return
+			default:
+			}
+			res, err := sm.Apply(m.req)
+			m.res <- memResult{res: res, err: err}
+		case <-p.done:
+			return
+		}
+	}
+}
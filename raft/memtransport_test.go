@@ -0,0 +1,195 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemTransport(t *testing.T) {
+	var trans Transport
+	mt := NewMemTransport()
+	defer mt.Close()
+	trans = mt
+
+	peers := []string{"a", "b", "c"}
+	stores := make(map[string]*MapStore)
+	for _, p := range peers {
+		stores[p] = NewMapStore()
+		mt.Register(p, stores[p])
+	}
+
+	for i, p := range peers {
+		for j := 0; j < 10; j++ {
+			req := SetCmd{Key: fmt.Sprint(j), Val: []byte(p)}
+			if _, err := trans.Send(peers[(i+1)%len(peers)], req); err != nil {
+				t.Fatalf("cannot send: %v", err)
+			}
+		}
+	}
+	for i, p := range peers {
+		from := peers[(i+len(peers)-1)%len(peers)]
+		res, err := trans.Send(p, GetCmd{Key: "9"})
+		if err != nil {
+			t.Fatalf("cannot get: %v", err)
+		}
+		if !bytes.Equal(res.([]byte), []byte(from)) {
+			t.Errorf("invalid value on %v: actual=%q want=%q", p, res, from)
+		}
+		if stores[p].Len() != 10 {
+			t.Errorf("invalid number of keys on %v: actual=%d want=%d", p,
+				stores[p].Len(), 10)
+		}
+	}
+
+	if _, err := trans.Send("a", GetCmd{Key: "none"}); err != ErrNoSuchKey {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchKey)
+	}
+
+	mt.Unregister("a")
+	if _, err := trans.Send("a", GetCmd{}); !errors.Is(err, ErrNoSuchPeer) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchPeer)
+	}
+}
+
+func TestMemTransportLatency(t *testing.T) {
+	mt := NewMemTransport()
+	defer mt.Close()
+	mt.Register("a", NewMapStore())
+	mt.SetLatency(10 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := mt.Send("a", SetCmd{Key: "k"}); err != nil {
+		t.Fatalf("cannot send: %v", err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("send is not delayed: actual=%v want>=%v", d,
+			20*time.Millisecond)
+	}
+}
+
+func TestMemTransportDrop(t *testing.T) {
+	mt := NewMemTransport()
+	defer mt.Close()
+	s := NewMapStore()
+	mt.Register("a", s)
+
+	mt.SetDropRate(1)
+	for i := 0; i < 10; i++ {
+		_, err := mt.Send("a", SetCmd{Key: "k"})
+		if !errors.Is(err, ErrDropped) {
+			t.Fatalf("invalid error: actual=%v want=%v", err, ErrDropped)
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("dropped requests are applied")
+	}
+
+	mt.SetDropRate(0.5)
+	const n = 200
+	ok := 0
+	for i := 0; i < n; i++ {
+		_, err := mt.Send("a", SetCmd{Key: fmt.Sprint(i)})
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, ErrDropped):
+			t.Fatalf("invalid error: actual=%v want=%v", err, ErrDropped)
+		}
+	}
+	if ok == 0 || ok == n {
+		t.Errorf("invalid number of delivered requests: %d of %d", ok, n)
+	}
+	if s.Len() < ok || s.Len() > n {
+		t.Errorf("invalid number of applied requests: actual=%d want=[%d, %d]",
+			s.Len(), ok, n)
+	}
+}
+
+// testGatedStore signals started and waits for gate before applying each
+// request.
+type testGatedStore struct {
+	*MapStore
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func (s testGatedStore) Apply(req interface{}) (interface{}, error) {
+	s.started <- struct{}{}
+	<-s.gate
+	return s.MapStore.Apply(req)
+}
+
+func TestMemTransportUnregisterInFlight(t *testing.T) {
+	mt := NewMemTransport()
+	defer mt.Close()
+	s := testGatedStore{
+		MapStore: NewMapStore(),
+		started:  make(chan struct{}, 10),
+		gate:     make(chan struct{}),
+	}
+	mt.Register("a", s)
+
+	errc := make(chan error, 10)
+	send := func(k string) {
+		_, err := mt.Send("a", SetCmd{Key: k})
+		errc <- err
+	}
+	go send("applying")
+	<-s.started
+	for i := 0; i < 5; i++ {
+		go send(fmt.Sprint("queued", i))
+	}
+	time.Sleep(10 * time.Millisecond)
+	mt.Unregister("a")
+	close(s.gate)
+
+	var applied, unapplied int
+	for i := 0; i < 6; i++ {
+		switch err := <-errc; {
+		case err == nil:
+			applied++
+		case errors.Is(err, ErrNoSuchPeer):
+			unapplied++
+		default:
+			t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchPeer)
+		}
+	}
+	if applied != 1 || unapplied != 5 {
+		t.Errorf("invalid sends: applied=%d unapplied=%d want=1,5", applied,
+			unapplied)
+	}
+	if s.Len() != 1 {
+		t.Errorf("invalid store length: actual=%d want=1", s.Len())
+	}
+}
+
+func TestMemPeerServeUnregistered(t *testing.T) {
+	// serve may see both a queued request and done, and select picks one at
+	// random. Repeat to make sure the request is never applied.
+	for i := 0; i < 20; i++ {
+		s := NewMapStore()
+		p := &memPeer{
+			inbox: make(chan memMessage, 1),
+			done:  make(chan struct{}),
+		}
+		m := memMessage{req: SetCmd{Key: "k"}, res: make(chan memResult, 1)}
+		p.inbox <- m
+		close(p.done)
+		p.serve(s)
+		if s.Len() != 0 {
+			t.Fatalf("request applied after unregister")
+		}
+		select {
+		case r := <-m.res:
+			if !r.unapplied {
+				t.Errorf("invalid result: actual=%+v want unapplied", r)
+			}
+		default:
+			// serve returned without receiving the request. Send returns
+			// ErrNoSuchPeer on done in that case.
+		}
+	}
+}
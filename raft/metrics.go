@@ -0,0 +1,38 @@
+package raft
+
+import "time"
+
+// SnapshotMetrics records the cost of saving and restoring snapshots.
+type SnapshotMetrics interface {
+	// ObserveSave is called after each Save with the size of the snapshot, the
+	// duration of Save and its error.
+	ObserveSave(size int, d time.Duration, err error)
+	// ObserveRestore is called after each Restore with the size of the
+	// snapshot, the duration of Restore and its error.
+	ObserveRestore(size int, d time.Duration, err error)
+}
+
+type instrumentedPersistent struct {
+	inner Persistent
+	m     SnapshotMetrics
+}
+
+// InstrumentedPersistent returns a Persistent that reports the size and the
+// duration of every Save and Restore of inner to m.
+func InstrumentedPersistent(inner Persistent, m SnapshotMetrics) Persistent {
+	return instrumentedPersistent{inner: inner, m: m}
+}
+
+func (p instrumentedPersistent) Save() ([]byte, error) {
+	start := time.Now()
+	b, err := p.inner.Save()
+	p.m.ObserveSave(len(b), time.Since(start), err)
+	return b, err
+}
+
+func (p instrumentedPersistent) Restore(b []byte) error {
+	start := time.Now()
+	err := p.inner.Restore(b)
+	p.m.ObserveRestore(len(b), time.Since(start), err)
+	return err
+}
@@ -0,0 +1,66 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+type testObservation struct {
+	size int
+	d    time.Duration
+	err  error
+}
+
+type testSnapshotMetrics struct {
+	saves    []testObservation
+	restores []testObservation
+}
+
+func (m *testSnapshotMetrics) ObserveSave(size int, d time.Duration,
+	err error) {
+
+	m.saves = append(m.saves, testObservation{size: size, d: d, err: err})
+}
+
+func (m *testSnapshotMetrics) ObserveRestore(size int, d time.Duration,
+	err error) {
+
+	m.restores = append(m.restores, testObservation{size: size, d: d, err: err})
+}
+
+func TestInstrumentedPersistent(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	m := &testSnapshotMetrics{}
+	p := InstrumentedPersistent(testSlowPersistent{
+		StateMachine: src,
+		delay:        10 * time.Millisecond,
+	}, m)
+
+	b, err := p.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if err := p.Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if err := p.Restore([]byte("invalid")); err == nil {
+		t.Fatal("no error for an invalid snapshot")
+	}
+
+	if len(m.saves) != 1 || len(m.restores) != 2 {
+		t.Fatalf("invalid number of observations: saves=%d restores=%d",
+			len(m.saves), len(m.restores))
+	}
+	if s := m.saves[0]; s.size != len(b) || s.d < 10*time.Millisecond ||
+		s.err != nil {
+
+		t.Errorf("invalid save observation: %#v", s)
+	}
+	if r := m.restores[0]; r.size != len(b) || r.err != nil {
+		t.Errorf("invalid restore observation: %#v", r)
+	}
+	if r := m.restores[1]; r.size != len("invalid") || r.err == nil {
+		t.Errorf("invalid failed restore observation: %#v", r)
+	}
+}
@@ -0,0 +1,69 @@
+package raft
+
+import (
+	"time"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/golang/glog"
+)
+
+// ApplyFunc applies a request and returns the response.
+type ApplyFunc func(req interface{}) (interface{}, error)
+
+// Middleware wraps an ApplyFunc with additional behavior. A middleware can
+// short-circuit the chain by returning without calling next.
+type Middleware func(next ApplyFunc) ApplyFunc
+
+type chainStateMachine struct {
+	StateMachine
+	apply ApplyFunc
+}
+
+func (c chainStateMachine) Apply(req interface{}) (interface{}, error) {
+	return c.apply(req)
+}
+
+func (c chainStateMachine) Reset() error {
+	return Reset(c.StateMachine)
+}
+
+// Chain returns a state machine that applies requests through mws and then
+// sm. Middlewares run in the order they are passed to Chain, i.e., mws[0] is
+// the outermost one.
+func Chain(sm StateMachine, mws ...Middleware) StateMachine {
+	apply := ApplyFunc(sm.Apply)
+	for i := len(mws) - 1; i >= 0; i-- {
+		apply = mws[i](apply)
+	}
+	return chainStateMachine{StateMachine: sm, apply: apply}
+}
+
+// TimingMiddleware returns a middleware that calls observe with the duration
+// and the error of every applied request.
+func TimingMiddleware(
+	observe func(req interface{}, d time.Duration, err error)) Middleware {
+
+	return func(next ApplyFunc) ApplyFunc {
+		return func(req interface{}) (interface{}, error) {
+			start := time.Now()
+			res, err := next(req)
+			observe(req, time.Since(start), err)
+			return res, err
+		}
+	}
+}
+
+// LoggingMiddleware returns a middleware that logs every applied request and
+// its response using glog at the given verbosity level.
+func LoggingMiddleware(level glog.Level) Middleware {
+	return func(next ApplyFunc) ApplyFunc {
+		return func(req interface{}) (interface{}, error) {
+			res, err := next(req)
+			if err != nil {
+				glog.V(level).Infof("raft applied %#v: error=%v", req, err)
+			} else {
+				glog.V(level).Infof("raft applied %#v: response=%#v", req, res)
+			}
+			return res, err
+		}
+	}
+}
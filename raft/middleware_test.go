@@ -0,0 +1,82 @@
+package raft
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testRecordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next ApplyFunc) ApplyFunc {
+		return func(req interface{}) (interface{}, error) {
+			*calls = append(*calls, name+":before")
+			res, err := next(req)
+			*calls = append(*calls, name+":after")
+			return res, err
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	s := NewMapStore()
+	sm := Chain(s, testRecordingMiddleware("1", &calls),
+		testRecordingMiddleware("2", &calls), LoggingMiddleware(4))
+	if _, err := sm.Apply(SetCmd{Key: "k", Val: []byte("v")}); err != nil {
+		t.Fatalf("cannot apply: %v", err)
+	}
+	want := []string{"1:before", "2:before", "2:after", "1:after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("invalid middleware calls: actual=%v want=%v", calls, want)
+	}
+	if s.Len() != 1 {
+		t.Errorf("request is not applied to the state machine")
+	}
+}
+
+func TestChainShortCircuit(t *testing.T) {
+	errRejected := errors.New("rejected")
+	reject := func(next ApplyFunc) ApplyFunc {
+		return func(req interface{}) (interface{}, error) {
+			if _, ok := req.(DeleteCmd); ok {
+				return nil, errRejected
+			}
+			return next(req)
+		}
+	}
+
+	var calls []string
+	s := NewMapStore()
+	sm := Chain(s, reject, testRecordingMiddleware("inner", &calls))
+	sm.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	if _, err := sm.Apply(DeleteCmd{Key: "k"}); err != errRejected {
+		t.Errorf("invalid error: actual=%v want=%v", err, errRejected)
+	}
+	if s.Len() != 1 {
+		t.Errorf("short-circuited request is applied")
+	}
+	if len(calls) != 2 {
+		t.Errorf("inner middleware is called after short-circuit: %v", calls)
+	}
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	var n int
+	var errs int
+	sm := Chain(NewMapStore(), TimingMiddleware(
+		func(req interface{}, d time.Duration, err error) {
+			n++
+			if err != nil {
+				errs++
+			}
+			if d < 0 {
+				t.Errorf("invalid duration: %v", d)
+			}
+		}))
+	sm.Apply(SetCmd{Key: "k"})
+	sm.Apply(GetCmd{Key: "none"})
+	if n != 2 || errs != 1 {
+		t.Errorf("invalid observations: actual=%d,%d want=%d,%d", n, errs, 2, 1)
+	}
+}
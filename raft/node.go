@@ -105,6 +105,9 @@ type group struct {
 	id           uint64
 	name         string
 	stateMachine StateMachine
+	applier      ContextApplier
+	applyCtx     context.Context
+	applyCnl     context.CancelFunc
 	raftStorage  *etcdraft.MemoryStorage
 	diskStorage  DiskStorage
 	fsyncTime    time.Duration
@@ -200,6 +203,7 @@ func (g *group) startApplier() {
 }
 
 func (g *group) stop() {
+	g.applyCnl()
 	select {
 	case g.stopc <- struct{}{}:
 	case <-g.saverDone:
@@ -374,7 +378,16 @@ func (g *group) applyEntry(e raftpb.Entry) error {
 	}
 	res := Response{ID: id}
 	if req.Data != nil {
-		res.Data, res.Err = g.stateMachine.Apply(req.Data)
+		// The apply context is only canceled when the group is stopping. An entry
+		// that is not applied because of that must not be marked as applied,
+		// otherwise the state machine silently skips a committed entry.
+		if g.applyCtx.Err() != nil {
+			return ErrStopped
+		}
+		res.Data, res.Err = g.applier.ApplyContext(g.applyCtx, req.Data)
+		if res.Err != nil && g.applyCtx.Err() != nil {
+			return ErrStopped
+		}
 	}
 	g.node.line.call(res)
 	return nil
@@ -472,13 +485,18 @@ func (g *group) applyConfChange(e raftpb.Entry) error {
 }
 
 func (g *group) snapshot() {
-	d, err := g.stateMachine.Save()
+	save, err := PrepareSave(g.stateMachine)
 	if err != nil {
 		glog.Fatalf("error in seralizing the state machine: %v", err)
 	}
 	g.snapped = g.applied
 
 	go func(snapi uint64) {
+		d, err := save()
+		if err != nil {
+			glog.Fatalf("error in seralizing the state machine: %v", err)
+		}
+
 		snap, err := g.raftStorage.CreateSnapshot(snapi, &g.confState, d)
 		if err != nil {
 			// the snapshot was done asynchronously with the progress of raft.
@@ -843,11 +861,15 @@ func (n *MultiNode) CreateGroup(ctx context.Context, cfg GroupConfig) error {
 		// TODO(soheil): Figure this one out:
 		//               Applied: lsi,
 	}
+	actx, acnl := context.WithCancel(context.Background())
 	g := &group{
 		node:         n,
 		id:           cfg.ID,
 		name:         cfg.Name,
 		stateMachine: cfg.StateMachine,
+		applier:      NewContextApplier(cfg.StateMachine),
+		applyCtx:     actx,
+		applyCnl:     acnl,
 		raftStorage:  rs,
 		diskStorage:  ds,
 		applyc:       make(chan etcdraft.Ready, cfg.SnapCount),
@@ -0,0 +1,53 @@
+package raft
+
+import (
+	"testing"
+	"time"
+
+	etcdraft "github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft"
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+	"github.com/kandoo/beehive/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func TestGroupStopWhileApplying(t *testing.T) {
+	n := &MultiNode{id: 1}
+	n.line.init()
+	c := &Counter{}
+	a := testSlowStore{StateMachine: c, delay: 20 * time.Millisecond}
+	ctx, cnl := context.WithCancel(context.Background())
+	g := &group{
+		node:         n,
+		stateMachine: c,
+		applier:      a,
+		applyCtx:     ctx,
+		applyCnl:     cnl,
+		snapCount:    1000,
+	}
+
+	var es []raftpb.Entry
+	for i := uint64(1); i <= 10; i++ {
+		b, err := n.encReq(RequestID{Node: 2, Seq: i}, Request{Data: IncrCmd{N: 1}})
+		if err != nil {
+			t.Fatalf("cannot encode request: %v", err)
+		}
+		es = append(es, raftpb.Entry{Index: i, Type: raftpb.EntryNormal, Data: b})
+	}
+
+	errc := make(chan error)
+	go func() {
+		errc <- g.apply(etcdraft.Ready{CommittedEntries: es})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	g.applyCnl()
+
+	if err := <-errc; err != ErrStopped {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrStopped)
+	}
+	if g.applied == uint64(len(es)) {
+		t.Fatal("all entries are applied before stopping")
+	}
+	if uint64(c.Value()) != g.applied {
+		t.Errorf("applied index does not match the state machine: applied=%d "+
+			"value=%d", g.applied, c.Value())
+	}
+}
@@ -0,0 +1,83 @@
+package raft
+
+import "sync"
+
+// Observer is called with the request and the response of every request that
+// is successfully applied.
+type Observer func(req, res interface{})
+
+// ObserverHandle identifies a registered observer.
+type ObserverHandle uint64
+
+type observer struct {
+	h  ObserverHandle
+	fn Observer
+}
+
+// ObservableStateMachine is a state machine that calls the registered
+// observers after each successful Apply. Observers are called in the order of
+// registration, on the goroutine that called Apply, and after the inner state
+// machine has returned.
+type ObservableStateMachine struct {
+	StateMachine
+
+	mu   sync.RWMutex
+	next ObserverHandle
+	obs  []observer
+}
+
+// NewObservable returns an ObservableStateMachine that applies requests using
+// sm.
+func NewObservable(sm StateMachine) *ObservableStateMachine {
+	return &ObservableStateMachine{StateMachine: sm}
+}
+
+// AddObserver registers fn and returns a handle that can be used to remove it.
+func (o *ObservableStateMachine) AddObserver(fn Observer) ObserverHandle {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.next++
+	o.obs = append(o.obs, observer{h: o.next, fn: fn})
+	return o.next
+}
+
+// RemoveObserver removes the observer registered with h. It returns false if
+// there is no such observer.
+func (o *ObservableStateMachine) RemoveObserver(h ObserverHandle) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, ob := range o.obs {
+		if ob.h != h {
+			continue
+		}
+		obs := make([]observer, 0, len(o.obs)-1)
+		obs = append(obs, o.obs[:i]...)
+		o.obs = append(obs, o.obs[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// Reset resets the inner state machine. Observers are kept.
+func (o *ObservableStateMachine) Reset() error {
+	return Reset(o.StateMachine)
+}
+
+// Apply applies req using the inner state machine and notifies the observers
+// if there was no error.
+func (o *ObservableStateMachine) Apply(req interface{}) (interface{}, error) {
+	res, err := o.StateMachine.Apply(req)
+	if err != nil {
+		return res, err
+	}
+
+	// o.obs is never modified in place, so it is safe to iterate over it
+	// without holding the lock.
+	o.mu.RLock()
+	obs := o.obs
+	o.mu.RUnlock()
+	for _, ob := range obs {
+		ob.fn(req, res)
+	}
+	return res, nil
+}
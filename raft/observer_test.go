@@ -0,0 +1,49 @@
+package raft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObservableStateMachine(t *testing.T) {
+	o := NewObservable(NewMapStore())
+	var calls []string
+	h1 := o.AddObserver(func(req, res interface{}) {
+		calls = append(calls, "1:"+req.(SetCmd).Key)
+	})
+	o.AddObserver(func(req, res interface{}) {
+		calls = append(calls, "2:"+req.(SetCmd).Key)
+	})
+
+	o.Apply(SetCmd{Key: "a"})
+	if _, err := o.Apply(GetCmd{Key: "none"}); err != ErrNoSuchKey {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchKey)
+	}
+	if !o.RemoveObserver(h1) {
+		t.Error("cannot remove the first observer")
+	}
+	if o.RemoveObserver(h1) {
+		t.Error("the first observer is removed twice")
+	}
+	o.Apply(SetCmd{Key: "b"})
+
+	want := []string{"1:a", "2:a", "2:b"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("invalid observer calls: actual=%v want=%v", calls, want)
+	}
+}
+
+func TestObservableStateMachineRemoveInObserver(t *testing.T) {
+	o := NewObservable(NewMapStore())
+	n := 0
+	var h ObserverHandle
+	h = o.AddObserver(func(req, res interface{}) {
+		n++
+		o.RemoveObserver(h)
+	})
+	o.Apply(SetCmd{Key: "a"})
+	o.Apply(SetCmd{Key: "b"})
+	if n != 1 {
+		t.Errorf("invalid number of calls: actual=%d want=%d", n, 1)
+	}
+}
@@ -0,0 +1,129 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrNotPointer is returned when a persistent value is not a non-nil
+	// pointer.
+	ErrNotPointer = newKindError("raft: persistent value is not a pointer",
+		ErrNotRecoverable)
+)
+
+type jsonPersistent struct {
+	v interface{}
+}
+
+// JSONPersistent returns a Persistent that saves v using encoding/json and
+// restores the saved bytes into v. v must be a non-nil pointer. A failed
+// Restore leaves v unchanged.
+//
+// A state machine can embed the returned Persistent to get Save and Restore:
+//
+//	type store struct {
+//		raft.Persistent
+//		state map[string]string
+//	}
+//
+//	s := &store{state: make(map[string]string)}
+//	s.Persistent = raft.JSONPersistent(&s.state)
+func JSONPersistent(v interface{}) Persistent {
+	return jsonPersistent{v: v}
+}
+
+func (p jsonPersistent) Save() ([]byte, error) {
+	return json.Marshal(p.v)
+}
+
+func (p jsonPersistent) Restore(b []byte) error {
+	err := restoreInto(p.v, func(v interface{}) error {
+		return json.Unmarshal(b, v)
+	})
+	if err != nil {
+		return fmt.Errorf("raft: cannot restore json snapshot of %d bytes: %w",
+			len(b), err)
+	}
+	return nil
+}
+
+type gobPersistent struct {
+	v interface{}
+}
+
+// GobPersistent returns a Persistent that saves v using encoding/gob and
+// restores the saved bytes into v. v must be a non-nil pointer. A failed
+// Restore leaves v unchanged.
+//
+// Concrete types stored in interface-typed fields of v must be registered
+// using gob.Register before calling Save or Restore. Note that gob output
+// depends on the Go types of v: snapshots may not be restorable after those
+// types are changed.
+func GobPersistent(v interface{}) Persistent {
+	return gobPersistent{v: v}
+}
+
+func (p gobPersistent) Save() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(p.v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p gobPersistent) Restore(b []byte) error {
+	err := restoreInto(p.v, func(v interface{}) error {
+		return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+	})
+	if err != nil {
+		return fmt.Errorf("raft: cannot restore gob snapshot of %d bytes: %w",
+			len(b), err)
+	}
+	return nil
+}
+
+// restoreInto decodes into a fresh value of v's element type and only then
+// replaces *v, so that fields missing in the snapshot are reset and a failed
+// decode does not leave v half-restored.
+func restoreInto(v interface{}, decode func(v interface{}) error) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrNotPointer
+	}
+	nv := reflect.New(rv.Elem().Type())
+	if err := decode(nv.Interface()); err != nil {
+		return fmt.Errorf("%w: %w", ErrSnapshotCorrupt, err)
+	}
+	rv.Elem().Set(nv.Elem())
+	return nil
+}
+
+type persistentStateMachine struct {
+	StateMachine
+	p Persistent
+}
+
+func (s persistentStateMachine) Save() ([]byte, error) {
+	return s.p.Save()
+}
+
+func (s persistentStateMachine) Restore(b []byte) error {
+	return s.p.Restore(b)
+}
+
+func (s persistentStateMachine) Reset() error {
+	return Reset(s.StateMachine)
+}
+
+// WithPersistent returns a state machine that applies requests using sm, and
+// saves and restores its state using p. It is used to plug a decorated
+// Persistent into a state machine:
+//
+//	sm = raft.WithPersistent(sm, raft.ChecksumPersistent(sm))
+func WithPersistent(sm StateMachine, p Persistent) StateMachine {
+	return persistentStateMachine{StateMachine: sm, p: p}
+}
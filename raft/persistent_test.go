@@ -0,0 +1,355 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+type testInner struct {
+	Name string
+	Tags []string
+}
+
+type testState struct {
+	ID    uint64
+	Inner testInner
+	Map   map[string]testInner
+	Ptr   *testInner
+}
+
+func newTestState() testState {
+	return testState{
+		ID:    1,
+		Inner: testInner{Name: "inner", Tags: []string{"a", "b"}},
+		Map: map[string]testInner{
+			"x": {Name: "x"},
+			"y": {Name: "y", Tags: []string{"y"}},
+		},
+		Ptr: &testInner{Name: "ptr"},
+	}
+}
+
+func testPersistentRoundTrip(t *testing.T, newP func(v *testState) Persistent) {
+	src := newTestState()
+	b, err := newP(&src).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	dst := testState{ID: 2, Inner: testInner{Name: "stale"}}
+	if err := newP(&dst).Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("invalid restored state: actual=%#v want=%#v", dst, src)
+	}
+}
+
+func testPersistentMalformed(t *testing.T, newP func(v *testState) Persistent) {
+	want := newTestState()
+	dst := newTestState()
+	if err := newP(&dst).Restore([]byte("{malformed")); err == nil {
+		t.Fatal("no error on malformed input")
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("state changed after a failed restore: actual=%#v want=%#v",
+			dst, want)
+	}
+}
+
+func newJSONTestPersistent(v *testState) Persistent {
+	return JSONPersistent(v)
+}
+
+func TestJSONPersistent(t *testing.T) {
+	testPersistentRoundTrip(t, newJSONTestPersistent)
+}
+
+func TestJSONPersistentMalformed(t *testing.T) {
+	testPersistentMalformed(t, newJSONTestPersistent)
+}
+
+func TestJSONPersistentNotPointer(t *testing.T) {
+	p := JSONPersistent(testState{})
+	b, err := p.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if err := p.Restore(b); !errors.Is(err, ErrNotPointer) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNotPointer)
+	}
+}
+
+func newGobTestPersistent(v *testState) Persistent {
+	return GobPersistent(v)
+}
+
+func TestGobPersistent(t *testing.T) {
+	testPersistentRoundTrip(t, newGobTestPersistent)
+}
+
+func TestGobPersistentMalformed(t *testing.T) {
+	testPersistentMalformed(t, newGobTestPersistent)
+}
+
+type testGobShape interface {
+	Area() int
+}
+
+type testGobRect struct{ W, H int }
+
+func (r testGobRect) Area() int { return r.W * r.H }
+
+type testGobSquare struct{ S int }
+
+func (s testGobSquare) Area() int { return s.S * s.S }
+
+func TestGobPersistentInterfaces(t *testing.T) {
+	gob.Register(testGobRect{})
+	gob.Register(testGobSquare{})
+
+	src := map[string]testGobShape{
+		"rect":   testGobRect{W: 2, H: 3},
+		"square": testGobSquare{S: 4},
+	}
+	b, err := GobPersistent(&src).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	var dst map[string]testGobShape
+	if err := GobPersistent(&dst).Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("invalid restored map: actual=%#v want=%#v", dst, src)
+	}
+}
+
+func TestRestoreErrorsUnwrap(t *testing.T) {
+	v := map[string]int{"key": 1}
+	err := JSONPersistent(&v).Restore([]byte("{"))
+	var serr *json.SyntaxError
+	if !errors.As(err, &serr) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("json error is not wrapped: %v", err)
+	}
+	if !strings.Contains(err.Error(), "json") ||
+		!strings.Contains(err.Error(), "1 bytes") {
+
+		t.Errorf("json error has no context: %v", err)
+	}
+
+	err = GobPersistent(&v).Restore([]byte{1, 2})
+	if err == nil || !strings.Contains(err.Error(), "gob") {
+		t.Errorf("gob error has no context: %v", err)
+	}
+
+	p := NewVersionedPersistent(ChecksumPersistent(JSONPersistent(&v)), 2)
+	b, _ := NewVersionedPersistent(JSONPersistent(&v), 3).Save()
+	err = p.Restore(b)
+	if !errors.Is(err, ErrUnknownVersion) ||
+		!strings.Contains(err.Error(), "version 3, want 2") {
+
+		t.Errorf("invalid version error: %v", err)
+	}
+
+	b, _ = NewVersionedPersistent(JSONPersistent(&v), 2).Save()
+	if err = p.Restore(b); !errors.Is(err, ErrChecksumMismatch) &&
+		!errors.Is(err, ErrUnknownChecksum) {
+
+		t.Errorf("checksum error is not wrapped: %v", err)
+	}
+
+	b, _ = NewVersionedPersistent(ChecksumPersistent(GobPersistent(&v)), 2).Save()
+	err = p.Restore(b)
+	if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.As(err, &serr) {
+		t.Errorf("inner error is not wrapped: %v", err)
+	}
+}
+
+type testRoundTripBase struct {
+	name string
+	// new returns a Persistent holding m and a function that computes the
+	// fingerprint of its current state.
+	new func(m map[string][]byte) (Persistent, func() ([]byte, error))
+}
+
+func newTestRoundTripMap(m map[string][]byte) (Persistent,
+	func() ([]byte, error)) {
+
+	s := NewMapStore()
+	for k, v := range m {
+		s.Apply(SetCmd{Key: k, Val: v})
+	}
+	return s, s.Fingerprint
+}
+
+func newTestRoundTripValue(newP func(v interface{}) Persistent) func(
+	m map[string][]byte) (Persistent, func() ([]byte, error)) {
+
+	return func(m map[string][]byte) (Persistent, func() ([]byte, error)) {
+		v := &m
+		return newP(v), func() ([]byte, error) {
+			_, fp := newTestRoundTripMap(*v)
+			return fp()
+		}
+	}
+}
+
+var testRoundTripBases = []testRoundTripBase{
+	{name: "map store", new: newTestRoundTripMap},
+	{name: "json", new: newTestRoundTripValue(JSONPersistent)},
+	{name: "gob", new: newTestRoundTripValue(GobPersistent)},
+}
+
+type testDecorator struct {
+	name string
+	wrap func(p Persistent) Persistent
+}
+
+func newTestDecorators(t *testing.T) []testDecorator {
+	key := bytes.Repeat([]byte{7}, 32)
+	return []testDecorator{
+		{name: "checksum", wrap: ChecksumPersistent},
+		{
+			name: "versioned",
+			wrap: func(p Persistent) Persistent {
+				return NewVersionedPersistent(p, 1)
+			},
+		},
+		{
+			name: "gzip",
+			wrap: func(p Persistent) Persistent {
+				return CompressedPersistent(p, GzipCompression)
+			},
+		},
+		{
+			name: "flate",
+			wrap: func(p Persistent) Persistent {
+				return CompressedPersistent(p, FlateCompression)
+			},
+		},
+		{
+			name: "encrypted",
+			wrap: func(p Persistent) Persistent { return mustEncrypt(t, p, key) },
+		},
+	}
+}
+
+// testOrderings returns all orderings of all subsets of n elements.
+func testOrderings(n int) [][]int {
+	var all [][]int
+	var gen func(prefix []int, used []bool)
+	gen = func(prefix []int, used []bool) {
+		all = append(all, append([]int(nil), prefix...))
+		for i := 0; i < n; i++ {
+			if used[i] {
+				continue
+			}
+			used[i] = true
+			gen(append(prefix, i), used)
+			used[i] = false
+		}
+	}
+	gen(nil, make([]bool, n))
+	return all
+}
+
+// testRoundTrip saves m using the save decorators and restores it using the
+// restore decorators, which are applied innermost first.
+func testRoundTrip(base testRoundTripBase, save, restore []testDecorator,
+	m map[string][]byte) error {
+
+	wrap := func(p Persistent, decs []testDecorator) Persistent {
+		for _, d := range decs {
+			p = d.wrap(p)
+		}
+		return p
+	}
+
+	src, srcFP := base.new(m)
+	b, err := wrap(src, save).Save()
+	if err != nil {
+		return fmt.Errorf("cannot save: %v", err)
+	}
+	dst, dstFP := base.new(nil)
+	if err := wrap(dst, restore).Restore(b); err != nil {
+		return fmt.Errorf("cannot restore: %v", err)
+	}
+
+	want, err := srcFP()
+	if err != nil {
+		return err
+	}
+	got, err := dstFP()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return errors.New("fingerprint mismatch")
+	}
+	return nil
+}
+
+func testRandomMap(vals []reflect.Value, r *rand.Rand) {
+	m := make(map[string][]byte)
+	for i, n := 0, r.Intn(20); i < n; i++ {
+		v := make([]byte, r.Intn(64))
+		r.Read(v)
+		m[fmt.Sprint(r.Int63())] = v
+	}
+	vals[0] = reflect.ValueOf(m)
+}
+
+func TestDecoratorRoundTrip(t *testing.T) {
+	decs := newTestDecorators(t)
+	cfg := &quick.Config{MaxCount: 3, Values: testRandomMap}
+	for _, base := range testRoundTripBases {
+		for _, o := range testOrderings(len(decs)) {
+			var chain []testDecorator
+			var names []string
+			for _, i := range o {
+				chain = append(chain, decs[i])
+				names = append(names, decs[i].name)
+			}
+			err := quick.Check(func(m map[string][]byte) bool {
+				if err := testRoundTrip(base, chain, chain, m); err != nil {
+					t.Logf("%v over %v: %v", names, base.name, err)
+					return false
+				}
+				return true
+			}, cfg)
+			if err != nil {
+				t.Errorf("invalid round trip of %v over %v: %v", names, base.name,
+					err)
+			}
+		}
+	}
+}
+
+func TestDecoratorRoundTripBrokenOrdering(t *testing.T) {
+	decs := newTestDecorators(t)
+	checksum, gzip := decs[0], decs[2]
+	save := []testDecorator{gzip, checksum}
+	restore := []testDecorator{checksum, gzip}
+
+	cfg := &quick.Config{MaxCount: 5, Values: testRandomMap}
+	for _, base := range testRoundTripBases {
+		err := quick.Check(func(m map[string][]byte) bool {
+			return testRoundTrip(base, save, restore, m) == nil
+		}, cfg)
+		if err == nil {
+			t.Errorf("round trip with mismatched orderings over %v succeeds",
+				base.name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+)
+
+var (
+	// ErrNoSuchNamespace is returned when no state machine is registered in
+	// the namespace of a request.
+	ErrNoSuchNamespace = errors.New("raft: no such namespace")
+	// ErrNamespaceExists is returned when a state machine is already
+	// registered in the namespace.
+	ErrNamespaceExists = errors.New("raft: namespace exists")
+)
+
+const registryVersion = 1
+
+// NamespacedRequest is a request for the state machine registered in
+// Namespace of a Registry.
+type NamespacedRequest struct {
+	Namespace string
+	Data      interface{}
+}
+
+// Registry is a state machine that hosts multiple independent state machines,
+// each registered in a namespace. Requests must be of type NamespacedRequest
+// and are applied to the state machine of their namespace. The snapshot of a
+// registry contains the snapshots of all registered state machines.
+type Registry struct {
+	mu  sync.RWMutex
+	sms map[string]StateMachine
+	p   *VersionedPersistent
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	r := &Registry{
+		sms: make(map[string]StateMachine),
+	}
+	r.p = NewVersionedPersistent(registryPersistent{r: r}, registryVersion)
+	return r
+}
+
+// Register registers sm in namespace ns.
+func (r *Registry) Register(ns string, sm StateMachine) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sms[ns]; ok {
+		return ErrNamespaceExists
+	}
+	r.sms[ns] = sm
+	return nil
+}
+
+// StateMachine returns the state machine registered in ns, or nil.
+func (r *Registry) StateMachine(ns string) StateMachine {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sms[ns]
+}
+
+// Namespaces returns the sorted list of registered namespaces.
+func (r *Registry) Namespaces() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nss := make([]string, 0, len(r.sms))
+	for ns := range r.sms {
+		nss = append(nss, ns)
+	}
+	sort.Strings(nss)
+	return nss
+}
+
+// Apply applies a NamespacedRequest to the state machine of its namespace.
+func (r *Registry) Apply(req interface{}) (interface{}, error) {
+	nr, ok := req.(NamespacedRequest)
+	if !ok {
+		return nil, fmt.Errorf("raft: registry request %#v: %w", req,
+			ErrUnknownCommand)
+	}
+	sm := r.StateMachine(nr.Namespace)
+	if sm == nil {
+		return nil, fmt.Errorf("raft: namespace %q: %w", nr.Namespace,
+			ErrNoSuchNamespace)
+	}
+	return sm.Apply(nr.Data)
+}
+
+// Save saves the snapshots of all registered state machines.
+func (r *Registry) Save() ([]byte, error) {
+	return r.p.Save()
+}
+
+// Restore restores the registered state machines from their snapshots in b.
+// Namespaces that have no snapshot in b are left untouched. If a state machine
+// fails to restore, the ones restored before it are not rolled back.
+func (r *Registry) Restore(b []byte) error {
+	return r.p.Restore(b)
+}
+
+// Reset resets all registered state machines. Namespaces remain registered.
+func (r *Registry) Reset() error {
+	for _, ns := range r.Namespaces() {
+		if err := Reset(r.StateMachine(ns)); err != nil {
+			return fmt.Errorf("raft: cannot reset namespace %q: %w", ns, err)
+		}
+	}
+	return nil
+}
+
+// ApplyConfChange passes the configuration change to all registered state
+// machines.
+func (r *Registry) ApplyConfChange(cc raftpb.ConfChange, gn GroupNode) error {
+	for _, ns := range r.Namespaces() {
+		if err := r.StateMachine(ns).ApplyConfChange(cc, gn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessStatusChange passes the event to all registered state machines.
+func (r *Registry) ProcessStatusChange(event interface{}) {
+	for _, ns := range r.Namespaces() {
+		r.StateMachine(ns).ProcessStatusChange(event)
+	}
+}
+
+type registrySnapshot struct {
+	Namespace string
+	Data      []byte
+}
+
+type registryPersistent struct {
+	r *Registry
+}
+
+func (p registryPersistent) Save() ([]byte, error) {
+	var snaps []registrySnapshot
+	for _, ns := range p.r.Namespaces() {
+		d, err := p.r.StateMachine(ns).Save()
+		if err != nil {
+			return nil, fmt.Errorf("raft: cannot save namespace %q: %w", ns, err)
+		}
+		snaps = append(snaps, registrySnapshot{Namespace: ns, Data: d})
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snaps); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p registryPersistent) Restore(b []byte) error {
+	var snaps []registrySnapshot
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&snaps); err != nil {
+		return fmt.Errorf(
+			"raft: cannot decode registry snapshot of %d bytes: %w: %w", len(b),
+			ErrSnapshotCorrupt, err)
+	}
+	for _, s := range snaps {
+		if p.r.StateMachine(s.Namespace) == nil {
+			return fmt.Errorf("raft: namespace %q: %w", s.Namespace,
+				ErrNoSuchNamespace)
+		}
+	}
+	for _, s := range snaps {
+		if err := p.r.StateMachine(s.Namespace).Restore(s.Data); err != nil {
+			return fmt.Errorf("raft: cannot restore namespace %q: %w", s.Namespace,
+				err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	gob.Register(NamespacedRequest{})
+}
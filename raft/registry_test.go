@@ -0,0 +1,79 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	a, b := NewMapStore(), NewMapStore()
+	r := NewRegistry()
+	if err := r.Register("a", a); err != nil {
+		t.Fatalf("cannot register a: %v", err)
+	}
+	if err := r.Register("b", b); err != nil {
+		t.Fatalf("cannot register b: %v", err)
+	}
+	if err := r.Register("a", b); err != ErrNamespaceExists {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNamespaceExists)
+	}
+
+	r.Apply(NamespacedRequest{Namespace: "a", Data: SetCmd{Key: "k",
+		Val: []byte("a")}})
+	r.Apply(NamespacedRequest{Namespace: "b", Data: SetCmd{Key: "k",
+		Val: []byte("b")}})
+	r.Apply(NamespacedRequest{Namespace: "b", Data: SetCmd{Key: "only-b"}})
+
+	if a.Len() != 1 || b.Len() != 2 {
+		t.Errorf("namespaces are not isolated: a=%d b=%d", a.Len(), b.Len())
+	}
+	for ns, want := range map[string]string{"a": "a", "b": "b"} {
+		v, err := r.Apply(NamespacedRequest{Namespace: ns,
+			Data: GetCmd{Key: "k"}})
+		if err != nil || !bytes.Equal(v.([]byte), []byte(want)) {
+			t.Errorf("invalid value in %v: actual=%q,%v want=%q", ns, v, err, want)
+		}
+	}
+	_, err := r.Apply(NamespacedRequest{Namespace: "c", Data: GetCmd{}})
+	if !errors.Is(err, ErrNoSuchNamespace) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchNamespace)
+	}
+	if _, err := r.Apply(GetCmd{Key: "k"}); err == nil {
+		t.Error("no error for a request without namespace")
+	}
+}
+
+func TestRegistrySaveRestore(t *testing.T) {
+	src := NewRegistry()
+	src.Register("a", NewMapStore())
+	src.Register("b", NewMapStore())
+	src.Apply(NamespacedRequest{Namespace: "a", Data: SetCmd{Key: "x"}})
+	src.Apply(NamespacedRequest{Namespace: "b", Data: SetCmd{Key: "y"}})
+	src.Apply(NamespacedRequest{Namespace: "b", Data: SetCmd{Key: "z"}})
+	snap, err := src.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	a, b := NewMapStore(), NewMapStore()
+	dst := NewRegistry()
+	dst.Register("a", a)
+	if err := dst.Restore(snap); !errors.Is(err, ErrNoSuchNamespace) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchNamespace)
+	}
+	if a.Len() != 0 {
+		t.Error("registry is partially restored")
+	}
+
+	dst.Register("b", b)
+	if err := dst.Restore(snap); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if a.Len() != 1 || b.Len() != 2 {
+		t.Errorf("invalid restored namespaces: a=%d b=%d", a.Len(), b.Len())
+	}
+	if _, err := a.Apply(GetCmd{Key: "y"}); err != ErrNoSuchKey {
+		t.Error("namespace b is restored into a")
+	}
+}
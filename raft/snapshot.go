@@ -0,0 +1,85 @@
+package raft
+
+import (
+	"bytes"
+	"io"
+)
+
+// Snapshot is a point-in-time snapshot of a state.
+type Snapshot interface {
+	// Persist writes the snapshot into w.
+	Persist(w io.Writer) error
+	// Release releases the resources held by the snapshot. The snapshot should
+	// not be used after it is released.
+	Release()
+}
+
+// Snapshotter is implemented by states that can take point-in-time snapshots.
+//
+// Snapshot is called while no request is being applied, and it should return
+// quickly; for example, by capturing a copy-on-write view of the state. The
+// returned snapshot, however, may be persisted concurrently with Apply, and
+// must not observe the requests applied after Snapshot returned.
+type Snapshotter interface {
+	// Snapshot returns a snapshot of the current state.
+	Snapshot() (Snapshot, error)
+}
+
+// NewSnapshotter returns p as a Snapshotter. If p does not implement
+// Snapshotter, the returned value takes snapshots using p.Save, which blocks
+// until the whole state is serialized.
+func NewSnapshotter(p Persistent) Snapshotter {
+	if s, ok := p.(Snapshotter); ok {
+		return s
+	}
+	return persistentSnapshotter{p: p}
+}
+
+type persistentSnapshotter struct {
+	p Persistent
+}
+
+func (s persistentSnapshotter) Snapshot() (Snapshot, error) {
+	b, err := s.p.Save()
+	if err != nil {
+		return nil, err
+	}
+	return &bytesSnapshot{b: b}, nil
+}
+
+type bytesSnapshot struct {
+	b []byte
+}
+
+func (s *bytesSnapshot) Persist(w io.Writer) error {
+	_, err := io.Copy(w, bytes.NewReader(s.b))
+	return err
+}
+
+func (s *bytesSnapshot) Release() {
+	s.b = nil
+}
+
+// Cloneable is implemented by state machines that can cheaply clone their
+// state, e.g., by a copy-on-write or a deep copy. The clone must not be
+// affected by the requests applied to the original state machine afterwards.
+type Cloneable interface {
+	// Clone returns a clone of the state machine.
+	Clone() StateMachine
+}
+
+// PrepareSave captures the current state of p and returns a function that
+// saves the captured state. If p implements Cloneable, PrepareSave only clones
+// p and the returned function saves the clone; hence, it can be called while
+// requests are applied to p. Otherwise, p is saved synchronously and the
+// returned function returns the saved bytes.
+func PrepareSave(p Persistent) (save func() ([]byte, error), err error) {
+	if c, ok := p.(Cloneable); ok {
+		return c.Clone().Save, nil
+	}
+	b, err := p.Save()
+	if err != nil {
+		return nil, err
+	}
+	return func() ([]byte, error) { return b, nil }, nil
+}
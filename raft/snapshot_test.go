@@ -0,0 +1,136 @@
+package raft
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type testSlowWriter struct {
+	w     io.Writer
+	delay time.Duration
+}
+
+func (w testSlowWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.w.Write(b)
+}
+
+func TestSnapshotterConcurrentApply(t *testing.T) {
+	const n = 1000
+	src := NewMapStore()
+	for i := 0; i < n; i++ {
+		src.Apply(SetCmd{Key: fmt.Sprintf("%d", i), Val: []byte("old")})
+	}
+
+	snap, err := NewSnapshotter(src).Snapshot()
+	if err != nil {
+		t.Fatalf("cannot take snapshot: %v", err)
+	}
+	defer snap.Release()
+
+	var buf bytes.Buffer
+	done := make(chan error)
+	go func() {
+		// MapStore writes each entry separately.
+		w := testSlowWriter{w: &buf, delay: 20 * time.Microsecond}
+		done <- snap.Persist(w)
+	}()
+
+	applied := 0
+	for i := 0; ; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("cannot persist snapshot: %v", err)
+			}
+			if applied == 0 {
+				t.Fatal("no request is applied while persisting")
+			}
+			dst := NewMapStore()
+			if err := dst.Restore(buf.Bytes()); err != nil {
+				t.Fatalf("cannot restore: %v", err)
+			}
+			if dst.Len() != n {
+				t.Errorf("invalid number of keys: actual=%d want=%d", dst.Len(), n)
+			}
+			for j := 0; j < n; j++ {
+				v, _ := dst.Apply(GetCmd{Key: fmt.Sprintf("%d", j)})
+				if !bytes.Equal(v.([]byte), []byte("old")) {
+					t.Fatalf("snapshot observed a later apply: %q", v)
+				}
+			}
+			return
+		default:
+			k := fmt.Sprintf("%d", i%(2*n))
+			src.Apply(SetCmd{Key: k, Val: []byte("new")})
+			applied++
+			// Let the writer run between applies.
+			runtime.Gosched()
+		}
+	}
+}
+
+func TestSnapshotterAdapter(t *testing.T) {
+	src := map[string]int{"a": 1}
+	snap, err := NewSnapshotter(JSONPersistent(&src)).Snapshot()
+	if err != nil {
+		t.Fatalf("cannot take snapshot: %v", err)
+	}
+	src["a"] = 2
+
+	var buf bytes.Buffer
+	if err := snap.Persist(&buf); err != nil {
+		t.Fatalf("cannot persist: %v", err)
+	}
+	snap.Release()
+	if buf.String() != `{"a":1}` {
+		t.Errorf("invalid snapshot: actual=%s want=%s", buf.String(), `{"a":1}`)
+	}
+}
+
+func TestPrepareSaveClone(t *testing.T) {
+	src := NewMapStore()
+	for i := 0; i < 100; i++ {
+		src.Apply(SetCmd{Key: fmt.Sprintf("%d", i), Val: []byte("old")})
+	}
+	want, _ := src.Save()
+
+	save, err := PrepareSave(src)
+	if err != nil {
+		t.Fatalf("cannot prepare save: %v", err)
+	}
+	done := make(chan []byte)
+	go func() {
+		b, err := save()
+		if err != nil {
+			t.Errorf("cannot save: %v", err)
+		}
+		done <- b
+	}()
+	for i := 0; i < 200; i++ {
+		src.Apply(SetCmd{Key: fmt.Sprintf("%d", i), Val: []byte("new")})
+	}
+	if b := <-done; !bytes.Equal(b, want) {
+		t.Error("snapshot does not reflect the state at the time of PrepareSave")
+	}
+	if src.Len() != 200 {
+		t.Errorf("invalid number of keys: actual=%d want=%d", src.Len(), 200)
+	}
+}
+
+func TestPrepareSaveFallback(t *testing.T) {
+	v := map[string]int{"a": 1}
+	save, err := PrepareSave(JSONPersistent(&v))
+	if err != nil {
+		t.Fatalf("cannot prepare save: %v", err)
+	}
+	v["a"] = 2
+	b, err := save()
+	if err != nil || string(b) != `{"a":1}` {
+		t.Errorf("invalid snapshot: actual=%s,%v want=%s", b, err, `{"a":1}`)
+	}
+}
@@ -1,6 +1,17 @@
 package raft
 
-import "github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+import (
+	"errors"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+	"github.com/kandoo/beehive/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+var (
+	// ErrNotResettable is returned when a state machine does not implement
+	// Resettable.
+	ErrNotResettable = errors.New("raft: state machine is not resettable")
+)
 
 // LeaderChanged indicate that the leader of the raft quorom is changed.
 type LeaderChanged struct {
@@ -9,12 +20,18 @@ type LeaderChanged struct {
 	Term uint64 // The raft term.
 }
 
-// StateMachine represents an application defined state.
-type StateMachine interface {
+// Persistent represents a state that can be saved into bytes and restored
+// from them.
+type Persistent interface {
 	// Save saves the store into bytes.
 	Save() ([]byte, error)
-	// Recover recovers the store from bytes.
+	// Restore recovers the store from bytes.
 	Restore(b []byte) error
+}
+
+// StateMachine represents an application defined state.
+type StateMachine interface {
+	Persistent
 	// Apply applies a request and returns the response.
 	Apply(req interface{}) (interface{}, error)
 	// ApplyConfChange processes a configuration change.
@@ -22,3 +39,113 @@ type StateMachine interface {
 	// ProcessStatusChange is called whenever the leader of the quorum is changed.
 	ProcessStatusChange(event interface{})
 }
+
+// ContextApplier is implemented by state machines whose Apply can be
+// cancelled. When a state machine implements ContextApplier, the node calls
+// ApplyContext instead of Apply, with a context that is cancelled when the
+// group is stopped.
+type ContextApplier interface {
+	// ApplyContext applies a request and returns the response. It should return
+	// ctx.Err() when ctx is done before the request is applied.
+	ApplyContext(ctx context.Context, req interface{}) (interface{}, error)
+}
+
+// NewContextApplier returns sm as a ContextApplier. If sm does not implement
+// ContextApplier, the returned value calls sm.Apply and ignores the context.
+func NewContextApplier(sm StateMachine) ContextApplier {
+	if ca, ok := sm.(ContextApplier); ok {
+		return ca
+	}
+	return contextApplier{sm: sm}
+}
+
+type contextApplier struct {
+	sm StateMachine
+}
+
+func (a contextApplier) ApplyContext(ctx context.Context,
+	req interface{}) (interface{}, error) {
+
+	return a.sm.Apply(req)
+}
+
+// ApplyResult is the result of applying a request in a batch.
+type ApplyResult struct {
+	Data interface{} // Data is the response of the request.
+	Err  error       // Err is the error returned for the request, if any.
+}
+
+// BatchApplier is implemented by state machines that can apply a batch of
+// requests more efficiently than applying them one by one, e.g., by holding a
+// lock once for the whole batch.
+type BatchApplier interface {
+	// ApplyBatch applies reqs in order and returns their results. The i-th
+	// result must correspond to the i-th request.
+	ApplyBatch(reqs []interface{}) []ApplyResult
+}
+
+// NewBatchApplier returns sm as a BatchApplier. If sm does not implement
+// BatchApplier, the returned value applies requests one by one using sm.Apply.
+func NewBatchApplier(sm StateMachine) BatchApplier {
+	if ba, ok := sm.(BatchApplier); ok {
+		return ba
+	}
+	return batchApplier{sm: sm}
+}
+
+type batchApplier struct {
+	sm StateMachine
+}
+
+func (a batchApplier) ApplyBatch(reqs []interface{}) []ApplyResult {
+	res := make([]ApplyResult, len(reqs))
+	for i, req := range reqs {
+		res[i].Data, res[i].Err = a.sm.Apply(req)
+	}
+	return res
+}
+
+// Querier is implemented by state machines that can serve read-only requests
+// without going through the raft log.
+type Querier interface {
+	// Query serves the read-only request and returns the response. Query must
+	// not modify the state.
+	Query(req interface{}) (interface{}, error)
+}
+
+// NewQuerier returns sm as a Querier. If sm does not implement Querier, the
+// returned value serves queries using sm.Apply. In that case the state machine
+// is responsible for not modifying its state when applying read-only requests.
+func NewQuerier(sm StateMachine) Querier {
+	if q, ok := sm.(Querier); ok {
+		return q
+	}
+	return querier{sm: sm}
+}
+
+type querier struct {
+	sm StateMachine
+}
+
+func (q querier) Query(req interface{}) (interface{}, error) {
+	return q.sm.Apply(req)
+}
+
+// Resettable is implemented by state machines that can be reset to their
+// initial state. After Reset, the state machine must be in the same state as a
+// freshly constructed one; in particular, its Save must return the same bytes.
+// Decorators in this package forward Reset to the state machines they wrap.
+type Resettable interface {
+	// Reset resets the state machine to its initial state.
+	Reset() error
+}
+
+// Reset resets sm if it implements Resettable, and returns ErrNotResettable
+// otherwise.
+func Reset(sm interface{}) error {
+	r, ok := sm.(Resettable)
+	if !ok {
+		return ErrNotResettable
+	}
+	return r.Reset()
+}
@@ -0,0 +1,214 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// testSlowStore applies requests after a delay, unless ctx is done by then.
+type testSlowStore struct {
+	StateMachine
+	delay time.Duration
+}
+
+func (s testSlowStore) ApplyContext(ctx context.Context,
+	req interface{}) (interface{}, error) {
+
+	select {
+	case <-time.After(s.delay):
+		return s.Apply(req)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// testSlowPersistent captures the state and then takes delay to finish saving
+// it.
+type testSlowPersistent struct {
+	StateMachine
+	delay time.Duration
+}
+
+func (p testSlowPersistent) Save() ([]byte, error) {
+	b, err := p.StateMachine.Save()
+	time.Sleep(p.delay)
+	return b, err
+}
+
+func TestContextApplierCancel(t *testing.T) {
+	m := NewMapStore()
+	s := testSlowStore{StateMachine: m, delay: time.Minute}
+	ca := NewContextApplier(s)
+	if _, ok := ca.(testSlowStore); !ok {
+		t.Fatalf("ContextApplier is wrapped: %#v", ca)
+	}
+
+	ctx, cnl := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cnl()
+	}()
+
+	start := time.Now()
+	_, err := ca.ApplyContext(ctx, SetCmd{Key: "k", Val: []byte("v")})
+	if err != context.Canceled {
+		t.Errorf("invalid error: actual=%v want=%v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("apply did not return promptly after cancellation: %v", d)
+	}
+	if m.Len() != 0 {
+		t.Errorf("cancelled request is applied")
+	}
+}
+
+func TestContextApplierAdapter(t *testing.T) {
+	s := NewMapStore()
+	ca := NewContextApplier(s)
+	ctx, cnl := context.WithCancel(context.Background())
+	cnl()
+	if _, err := ca.ApplyContext(ctx, SetCmd{Key: "k", Val: []byte("v")}); err !=
+		nil {
+
+		t.Fatalf("cannot apply: %v", err)
+	}
+	v, err := ca.ApplyContext(ctx, GetCmd{Key: "k"})
+	if err != nil || !bytes.Equal(v.([]byte), []byte("v")) {
+		t.Errorf("invalid value: actual=%q,%v want=%q", v, err, "v")
+	}
+}
+
+func TestBatchApplier(t *testing.T) {
+	s := NewMapStore()
+	reqs := []interface{}{
+		SetCmd{Key: "a", Val: []byte("1")},
+		GetCmd{Key: "a"},
+		GetCmd{Key: "b"},
+		"invalid",
+		DeleteCmd{Key: "a"},
+		GetCmd{Key: "a"},
+	}
+	res := NewBatchApplier(s).ApplyBatch(reqs)
+	if len(res) != len(reqs) {
+		t.Fatalf("invalid number of results: actual=%d want=%d", len(res),
+			len(reqs))
+	}
+
+	for i, r := range res {
+		switch i {
+		case 1:
+			if r.Err != nil || !bytes.Equal(r.Data.([]byte), []byte("1")) {
+				t.Errorf("invalid result %d: actual=%q,%v want=%q", i, r.Data, r.Err,
+					"1")
+			}
+		case 2, 5:
+			if r.Err != ErrNoSuchKey {
+				t.Errorf("invalid error %d: actual=%v want=%v", i, r.Err, ErrNoSuchKey)
+			}
+		case 3:
+			if r.Err == nil {
+				t.Errorf("no error for invalid request %d", i)
+			}
+		default:
+			if r.Err != nil || r.Data != nil {
+				t.Errorf("invalid result %d: actual=%v,%v want=nil,nil", i, r.Data,
+					r.Err)
+			}
+		}
+	}
+}
+
+func TestQuerier(t *testing.T) {
+	s := NewMapStore()
+	s.Apply(SetCmd{Key: "k", Val: []byte("v")})
+	before, err := s.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	q := NewQuerier(s)
+	v, err := q.Query(GetCmd{Key: "k"})
+	if err != nil || !bytes.Equal(v.([]byte), []byte("v")) {
+		t.Errorf("invalid query response: actual=%q,%v want=%q", v, err, "v")
+	}
+	if _, err := q.Query(DeleteCmd{Key: "k"}); err == nil {
+		t.Error("no error for a mutating query")
+	}
+
+	after, err := s.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("query changed the snapshot")
+	}
+}
+
+func TestQuerierAdapter(t *testing.T) {
+	c := &testTypedCounter{n: 3}
+	v, err := NewQuerier(Untyped[int64, int64](c)).Query(int64(0))
+	if err != nil || v.(int64) != 3 {
+		t.Errorf("invalid query response: actual=%v,%v want=%v", v, err, 3)
+	}
+}
+
+func TestReset(t *testing.T) {
+	fresh := func() []StateMachine { return []StateMachine{NewMapStore(), &Counter{}} }
+	reqs := []interface{}{SetCmd{Key: "k", Val: []byte("v")}, IncrCmd{N: 3}}
+	decorators := []func(sm StateMachine) StateMachine{
+		func(sm StateMachine) StateMachine { return sm },
+		func(sm StateMachine) StateMachine { return SyncStateMachine(sm) },
+		func(sm StateMachine) StateMachine { return NewObservable(sm) },
+		func(sm StateMachine) StateMachine { return Chain(sm) },
+		func(sm StateMachine) StateMachine { return WithPersistent(sm, sm) },
+		func(sm StateMachine) StateMachine {
+			return LoggingStateMachine(sm, ioutil.Discard)
+		},
+		func(sm StateMachine) StateMachine {
+			return NewIdempotent(SyncStateMachine(sm), 1)
+		},
+	}
+
+	for i, dec := range decorators {
+		for j, sm := range fresh() {
+			want, _ := fresh()[j].Save()
+			d := dec(sm)
+			d.Apply(reqs[j])
+			if b, _ := sm.Save(); bytes.Equal(b, want) {
+				t.Fatalf("request %d is not applied", j)
+			}
+			if err := Reset(d); err != nil {
+				t.Fatalf("cannot reset decorator %d: %v", i, err)
+			}
+			if b, _ := sm.Save(); !bytes.Equal(b, want) {
+				t.Errorf("decorator %d does not forward reset to %T", i, sm)
+			}
+		}
+	}
+}
+
+func TestResetRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register("m", NewMapStore())
+	r.Register("c", &Counter{})
+	want, _ := r.Save()
+	r.Apply(NamespacedRequest{Namespace: "m", Data: SetCmd{Key: "k"}})
+	r.Apply(NamespacedRequest{Namespace: "c", Data: IncrCmd{N: 1}})
+	if err := r.Reset(); err != nil {
+		t.Fatalf("cannot reset: %v", err)
+	}
+	if b, _ := r.Save(); !bytes.Equal(b, want) {
+		t.Error("registry is not reset")
+	}
+
+	r.Register("not-resettable", WithPersistent(Untyped[int64, int64](
+		&testTypedCounter{}), NewMapStore()))
+	if err := r.Reset(); !errors.Is(err, ErrNotResettable) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNotResettable)
+	}
+}
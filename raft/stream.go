@@ -0,0 +1,47 @@
+package raft
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// StreamingPersistent is implemented by states that can write their snapshots
+// into and read them from a stream, without buffering the whole snapshot in
+// memory.
+type StreamingPersistent interface {
+	// WriteSnapshot writes the snapshot of the state into w.
+	WriteSnapshot(w io.Writer) error
+	// ReadSnapshot restores the state from the snapshot read from r.
+	ReadSnapshot(r io.Reader) error
+}
+
+// Streaming returns p as a StreamingPersistent. If p does not implement
+// StreamingPersistent, the returned value falls back to Save and Restore and
+// buffers the snapshot in memory.
+func Streaming(p Persistent) StreamingPersistent {
+	if sp, ok := p.(StreamingPersistent); ok {
+		return sp
+	}
+	return bufferedStream{p: p}
+}
+
+type bufferedStream struct {
+	p Persistent
+}
+
+func (s bufferedStream) WriteSnapshot(w io.Writer) error {
+	b, err := s.p.Save()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (s bufferedStream) ReadSnapshot(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.p.Restore(b)
+}
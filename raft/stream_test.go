@@ -0,0 +1,54 @@
+package raft
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestStreamingLargeStore(t *testing.T) {
+	const n = 100000
+	src := NewMapStore()
+	for i := 0; i < n; i++ {
+		k := fmt.Sprintf("key-%d", i)
+		src.Apply(SetCmd{Key: k, Val: bytes.Repeat([]byte{byte(i)}, 64)})
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(Streaming(src).WriteSnapshot(w))
+	}()
+
+	dst := NewMapStore()
+	if err := Streaming(dst).ReadSnapshot(r); err != nil {
+		t.Fatalf("cannot read snapshot: %v", err)
+	}
+	if dst.Len() != n {
+		t.Fatalf("invalid number of keys: actual=%d want=%d", dst.Len(), n)
+	}
+	v, err := dst.Apply(GetCmd{Key: "key-42"})
+	if err != nil || !bytes.Equal(v.([]byte), bytes.Repeat([]byte{42}, 64)) {
+		t.Errorf("invalid value for key-42: %q, %v", v, err)
+	}
+}
+
+func TestStreamingFallback(t *testing.T) {
+	src := map[string]int{"a": 1, "b": 2}
+	sp := Streaming(JSONPersistent(&src))
+	if _, ok := sp.(bufferedStream); !ok {
+		t.Fatalf("invalid streaming adapter: %#v", sp)
+	}
+
+	var buf bytes.Buffer
+	if err := sp.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("cannot write snapshot: %v", err)
+	}
+	var dst map[string]int
+	if err := Streaming(JSONPersistent(&dst)).ReadSnapshot(&buf); err != nil {
+		t.Fatalf("cannot read snapshot: %v", err)
+	}
+	if len(dst) != 2 || dst["a"] != 1 || dst["b"] != 2 {
+		t.Errorf("invalid restored map: actual=%v want=%v", dst, src)
+	}
+}
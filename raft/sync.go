@@ -0,0 +1,74 @@
+package raft
+
+import (
+	"sync"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+)
+
+type syncStateMachine struct {
+	mu sync.RWMutex
+	sm StateMachine
+	q  Querier
+}
+
+// SyncStateMachine returns a state machine that is safe for concurrent use.
+// Apply, Restore, ApplyConfChange and ProcessStatusChange hold an exclusive
+// lock, while Save and Query hold a shared lock.
+//
+// SyncStateMachine is a convenience for simple state machines. It serializes
+// every request, and it is not a substitute for a state machine designed for
+// concurrency.
+func SyncStateMachine(sm StateMachine) StateMachine {
+	return &syncStateMachine{sm: sm, q: NewQuerier(sm)}
+}
+
+func (s *syncStateMachine) Save() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sm.Save()
+}
+
+func (s *syncStateMachine) Restore(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sm.Restore(b)
+}
+
+func (s *syncStateMachine) Apply(req interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sm.Apply(req)
+}
+
+// Query serves the read-only request using the inner state machine. If the
+// inner state machine does not implement Querier, the request is applied
+// while holding the exclusive lock.
+func (s *syncStateMachine) Query(req interface{}) (interface{}, error) {
+	if _, ok := s.q.(querier); ok {
+		return s.Apply(req)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q.Query(req)
+}
+
+func (s *syncStateMachine) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Reset(s.sm)
+}
+
+func (s *syncStateMachine) ApplyConfChange(cc raftpb.ConfChange,
+	gn GroupNode) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sm.ApplyConfChange(cc, gn)
+}
+
+func (s *syncStateMachine) ProcessStatusChange(event interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sm.ProcessStatusChange(event)
+}
@@ -0,0 +1,52 @@
+package raft
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSyncStateMachine(t *testing.T) {
+	const (
+		workers = 16
+		reqs    = 200
+	)
+
+	sm := SyncStateMachine(NewMapStore())
+	q := NewQuerier(sm)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < reqs; i++ {
+				k := fmt.Sprintf("%d-%d", w, i)
+				if _, err := sm.Apply(SetCmd{Key: k, Val: []byte(k)}); err != nil {
+					t.Errorf("cannot set %v: %v", k, err)
+				}
+				if _, err := q.Query(GetCmd{Key: k}); err != nil {
+					t.Errorf("cannot get %v: %v", k, err)
+				}
+				if i%50 == 0 {
+					if _, err := sm.Save(); err != nil {
+						t.Errorf("cannot save: %v", err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	b, err := sm.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	s := NewMapStore()
+	if err := SyncStateMachine(s).Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if s.Len() != workers*reqs {
+		t.Errorf("invalid number of keys: actual=%d want=%d", s.Len(),
+			workers*reqs)
+	}
+}
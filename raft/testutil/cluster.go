@@ -0,0 +1,248 @@
+// Package testutil provides helpers to test the state machines of the raft
+// package in a single process.
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/kandoo/beehive/raft"
+)
+
+type clusterNode struct {
+	name  string
+	sm    raft.StateMachine
+	alive bool
+
+	applied   int
+	snap      []byte
+	snapIndex int
+}
+
+// TestCluster is a cluster of nodes, each with a MapStore, connected using a
+// MemTransport. Requests applied to the cluster are appended to a log and sent
+// to every reachable node. Nodes that are partitioned miss the requests until
+// they are healed, at which point they catch up by applying the missed
+// requests in order.
+//
+// TestCluster is safe for concurrent use, but requests are applied one at a
+// time. Requests dropped by Transport are not retried, hence nodes may diverge
+// when message loss is injected.
+type TestCluster struct {
+	// Transport is the transport connecting the nodes. It can be used to
+	// inject latency and message loss.
+	Transport *raft.MemTransport
+
+	mu    sync.Mutex
+	log   []interface{}
+	nodes map[string]*clusterNode
+}
+
+// NewTestCluster creates a cluster of n nodes, named "node0" to "node<n-1>".
+func NewTestCluster(n int) *TestCluster {
+	c := &TestCluster{
+		Transport: raft.NewMemTransport(),
+		nodes:     make(map[string]*clusterNode),
+	}
+	for i := 0; i < n; i++ {
+		nd := &clusterNode{name: fmt.Sprintf("node%d", i), alive: true}
+		c.nodes[nd.name] = nd
+		c.start(nd)
+	}
+	return c
+}
+
+// Nodes returns the sorted names of the nodes.
+func (c *TestCluster) Nodes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.nodes))
+	for n := range c.nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StateMachine returns the state machine of node, or nil if there is no such
+// node. The returned state machine is replaced when the node restarts.
+func (c *TestCluster) StateMachine(node string) raft.StateMachine {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if nd, ok := c.nodes[node]; ok {
+		return nd.sm
+	}
+	return nil
+}
+
+// Apply appends req to the log and sends it to all reachable nodes. It
+// returns the response of the first reachable node, in the order of their
+// names, and the first error returned by any node.
+func (c *TestCluster) Apply(req interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.log = append(c.log, req)
+	var res interface{}
+	var err error
+	first := true
+	for _, nd := range c.sortedNodes() {
+		if !nd.alive {
+			continue
+		}
+		r, rerr := c.catchUp(nd)
+		if first {
+			res, first = r, false
+		}
+		if err == nil {
+			err = rerr
+		}
+	}
+	return res, err
+}
+
+// Partition disconnects nodes from the cluster. Partitioned nodes miss the
+// requests applied to the cluster, and cannot be reached via Transport.
+func (c *TestCluster) Partition(nodes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range nodes {
+		nd := c.mustNode(n)
+		nd.alive = false
+		c.Transport.Unregister(n)
+	}
+}
+
+// Heal reconnects the partitioned nodes and applies the requests they have
+// missed. The responses of the missed requests are discarded, since they are
+// already returned by Apply.
+func (c *TestCluster) Heal(nodes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range nodes {
+		nd := c.mustNode(n)
+		if nd.alive {
+			continue
+		}
+		c.Transport.Register(n, nd.sm)
+		nd.alive = true
+		c.catchUp(nd)
+	}
+}
+
+// Snapshot persists the current state of node. When the node restarts, it is
+// restored from its last snapshot.
+func (c *TestCluster) Snapshot(node string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nd := c.mustNode(node)
+	b, err := nd.sm.Save()
+	if err != nil {
+		return err
+	}
+	nd.snap, nd.snapIndex = b, nd.applied
+	return nil
+}
+
+// Restart replaces the state machine of node with a new MapStore restored
+// from the last snapshot of the node, losing the requests applied after that
+// snapshot. If the node is not partitioned, it then applies the requests it
+// has lost. Restart only returns an error if the snapshot cannot be restored.
+func (c *TestCluster) Restart(node string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nd := c.mustNode(node)
+	if nd.alive {
+		c.Transport.Unregister(node)
+	}
+	if err := c.start(nd); err != nil {
+		return err
+	}
+	if nd.alive {
+		c.catchUp(nd)
+	}
+	return nil
+}
+
+// Snapshots returns the saved state of each node.
+func (c *TestCluster) Snapshots() (map[string][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snaps := make(map[string][]byte, len(c.nodes))
+	for n, nd := range c.nodes {
+		b, err := nd.sm.Save()
+		if err != nil {
+			return nil, fmt.Errorf("cannot save %v: %v", n, err)
+		}
+		snaps[n] = b
+	}
+	return snaps, nil
+}
+
+// AssertConverged reports an error on t unless all nodes have the same state.
+func (c *TestCluster) AssertConverged(t testing.TB) {
+	t.Helper()
+	snaps, err := c.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := c.Nodes()
+	for _, n := range names[1:] {
+		if !bytes.Equal(snaps[n], snaps[names[0]]) {
+			t.Errorf("%v and %v have not converged", n, names[0])
+		}
+	}
+}
+
+// Close stops all nodes.
+func (c *TestCluster) Close() {
+	c.Transport.Close()
+}
+
+// start creates a new state machine for nd, restored from its last snapshot.
+func (c *TestCluster) start(nd *clusterNode) error {
+	s := raft.NewMapStore()
+	if nd.snap != nil {
+		if err := s.Restore(nd.snap); err != nil {
+			return fmt.Errorf("cannot restore %v: %v", nd.name, err)
+		}
+	}
+	nd.sm = raft.SyncStateMachine(s)
+	nd.applied = nd.snapIndex
+	if nd.alive {
+		c.Transport.Register(nd.name, nd.sm)
+	}
+	return nil
+}
+
+// catchUp sends the requests nd has not applied, and returns the response and
+// the error of the last request.
+func (c *TestCluster) catchUp(nd *clusterNode) (interface{}, error) {
+	var res interface{}
+	var err error
+	for nd.applied < len(c.log) {
+		res, err = c.Transport.Send(nd.name, c.log[nd.applied])
+		nd.applied++
+	}
+	return res, err
+}
+
+func (c *TestCluster) mustNode(node string) *clusterNode {
+	nd, ok := c.nodes[node]
+	if !ok {
+		panic(fmt.Sprintf("testutil: no such node %q", node))
+	}
+	return nd
+}
+
+func (c *TestCluster) sortedNodes() []*clusterNode {
+	nds := make([]*clusterNode, 0, len(c.nodes))
+	for _, nd := range c.nodes {
+		nds = append(nds, nd)
+	}
+	sort.Slice(nds, func(i, j int) bool { return nds[i].name < nds[j].name })
+	return nds
+}
@@ -0,0 +1,103 @@
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/kandoo/beehive/raft"
+)
+
+func testClusterGet(t *testing.T, c *TestCluster, node, key string) []byte {
+	v, err := c.StateMachine(node).Apply(raft.GetCmd{Key: key})
+	if err != nil {
+		t.Fatalf("cannot get %v from %v: %v", key, node, err)
+	}
+	return v.([]byte)
+}
+
+func TestClusterApply(t *testing.T) {
+	c := NewTestCluster(3)
+	defer c.Close()
+
+	if n := len(c.Nodes()); n != 3 {
+		t.Fatalf("invalid number of nodes: actual=%d want=%d", n, 3)
+	}
+	for i := 0; i < 10; i++ {
+		_, err := c.Apply(raft.SetCmd{Key: fmt.Sprint(i), Val: []byte("v")})
+		if err != nil {
+			t.Fatalf("cannot apply: %v", err)
+		}
+	}
+	res, err := c.Apply(raft.GetCmd{Key: "3"})
+	if err != nil || !bytes.Equal(res.([]byte), []byte("v")) {
+		t.Errorf("invalid response: actual=%q, %v want=%q", res, err, "v")
+	}
+	if _, err = c.Apply(raft.GetCmd{Key: "none"}); err != raft.ErrNoSuchKey {
+		t.Errorf("invalid error: actual=%v want=%v", err, raft.ErrNoSuchKey)
+	}
+	c.AssertConverged(t)
+}
+
+func TestClusterPartition(t *testing.T) {
+	c := NewTestCluster(3)
+	defer c.Close()
+
+	c.Apply(raft.SetCmd{Key: "k", Val: []byte("1")})
+	c.Partition("node2")
+	c.Apply(raft.SetCmd{Key: "k", Val: []byte("2")})
+	c.Apply(raft.DeleteCmd{Key: "k"})
+	c.Apply(raft.SetCmd{Key: "p", Val: []byte("3")})
+
+	if _, err := c.Transport.Send("node2", raft.GetCmd{}); err == nil {
+		t.Error("partitioned node is reachable")
+	}
+	if v := testClusterGet(t, c, "node2", "k"); !bytes.Equal(v, []byte("1")) {
+		t.Errorf("partitioned node applied requests: actual=%q want=%q", v, "1")
+	}
+	snaps, err := c.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(snaps["node0"], snaps["node2"]) {
+		t.Error("partitioned node has converged")
+	}
+
+	c.Heal("node2")
+	c.AssertConverged(t)
+	if v := testClusterGet(t, c, "node2", "p"); !bytes.Equal(v, []byte("3")) {
+		t.Errorf("invalid value after heal: actual=%q want=%q", v, "3")
+	}
+}
+
+func TestClusterRestart(t *testing.T) {
+	c := NewTestCluster(2)
+	defer c.Close()
+
+	c.Apply(raft.SetCmd{Key: "a", Val: []byte("a")})
+	if err := c.Snapshot("node1"); err != nil {
+		t.Fatalf("cannot snapshot: %v", err)
+	}
+	c.Apply(raft.SetCmd{Key: "b", Val: []byte("b")})
+
+	c.Partition("node1")
+	if err := c.Restart("node1"); err != nil {
+		t.Fatalf("cannot restart: %v", err)
+	}
+	sm := c.StateMachine("node1")
+	if _, err := sm.Apply(raft.GetCmd{Key: "b"}); err != raft.ErrNoSuchKey {
+		t.Errorf("restarted node is not restored from its snapshot: %v", err)
+	}
+	testClusterGet(t, c, "node1", "a")
+
+	c.Heal("node1")
+	c.AssertConverged(t)
+
+	if err := c.Restart("node0"); err != nil {
+		t.Fatalf("cannot restart: %v", err)
+	}
+	c.AssertConverged(t)
+	if v := testClusterGet(t, c, "node0", "b"); !bytes.Equal(v, []byte("b")) {
+		t.Errorf("invalid value after restart: actual=%q want=%q", v, "b")
+	}
+}
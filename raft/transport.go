@@ -0,0 +1,207 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSuchPeer is returned when the peer of a request is not known to the
+	// transport.
+	ErrNoSuchPeer = errors.New("raft: no such peer")
+	// ErrResponseNotEncodable is returned when the peer has applied the request
+	// but cannot encode its response. The request must not be retried unless it
+	// is idempotent.
+	ErrResponseNotEncodable = errors.New(
+		"raft: request is applied but its response cannot be encoded")
+)
+
+const (
+	// TransportPath is the HTTP path on which TransportHandler serves requests.
+	TransportPath = "/raft/v1/apply"
+	// TransportMaxRequestSize is the maximum size of an encoded request that
+	// TransportHandler accepts.
+	TransportMaxRequestSize = 64 << 20
+
+	// transportErrorHeader carries the error returned by the state machine.
+	transportErrorHeader = "X-Raft-Error"
+	// transportEncodeErrorHeader carries the error of encoding the response of
+	// an applied request.
+	transportEncodeErrorHeader = "X-Raft-Encode-Error"
+)
+
+// Transport sends requests to the state machines of peers.
+type Transport interface {
+	// Send applies req on the state machine of peer, and returns its response.
+	Send(peer string, req interface{}) (interface{}, error)
+}
+
+// HTTPTransport is a Transport that sends requests to a TransportHandler of
+// each peer over HTTP. Requests and responses are encoded using a Codec, and
+// hence their types must be registered in the type registry of the codec.
+// Errors returned by the remote state machine only retain their message.
+//
+// Connections are kept alive and reused, with at most maxConnsPerPeer
+// connections to each peer. When all connections to a peer are busy, Send
+// waits for one to become available.
+type HTTPTransport struct {
+	client *http.Client
+	codec  Codec
+
+	mu    sync.RWMutex
+	peers map[string]string
+}
+
+// NewHTTPTransport creates an HTTPTransport with at most maxConnsPerPeer
+// connections to each peer. Zero means no limit. Send fails if the peer does
+// not respond within timeout; zero means no timeout, in which case a hung peer
+// blocks Send forever. If codec is nil, GobCodec(nil) is used. Peers must use
+// the same codec in their TransportHandler.
+func NewHTTPTransport(maxConnsPerPeer int, timeout time.Duration,
+	codec Codec) *HTTPTransport {
+
+	if codec == nil {
+		codec = GobCodec(nil)
+	}
+	return &HTTPTransport{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				MaxConnsPerHost:     maxConnsPerPeer,
+				MaxIdleConnsPerHost: maxConnsPerPeer,
+			},
+		},
+		codec: codec,
+		peers: make(map[string]string),
+	}
+}
+
+// AddPeer sets the address of peer. addr is a host:port pair.
+func (t *HTTPTransport) AddPeer(peer, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.peers[peer] = addr
+}
+
+// RemovePeer removes peer from the transport.
+func (t *HTTPTransport) RemovePeer(peer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.peers, peer)
+}
+
+// Send sends req to the TransportHandler of peer.
+func (t *HTTPTransport) Send(peer string, req interface{}) (interface{},
+	error) {
+
+	t.mu.RLock()
+	addr, ok := t.peers[peer]
+	t.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("raft: peer %q: %w", peer, ErrNoSuchPeer)
+	}
+
+	b, err := t.codec.Encode(req)
+	if err != nil {
+		return nil, err
+	}
+	hres, err := t.client.Post("http://"+addr+TransportPath,
+		"application/octet-stream", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer hres.Body.Close()
+	b, err = ioutil.ReadAll(hres.Body)
+	if err != nil {
+		return nil, err
+	}
+	if hres.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("raft: peer %q returned %v: %s", peer,
+			hres.Status, bytes.TrimSpace(b))
+	}
+
+	if msg := hres.Header.Get(transportEncodeErrorHeader); msg != "" {
+		if amsg := hres.Header.Get(transportErrorHeader); amsg != "" {
+			return nil, fmt.Errorf("raft: peer %q: %s: %w: %w", peer, msg,
+				ErrResponseNotEncodable, errors.New(amsg))
+		}
+		return nil, fmt.Errorf("raft: peer %q: %s: %w", peer, msg,
+			ErrResponseNotEncodable)
+	}
+	res, err := t.codec.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if msg := hres.Header.Get(transportErrorHeader); msg != "" {
+		return res, errors.New(msg)
+	}
+	return res, nil
+}
+
+// Close closes the idle connections of the transport.
+func (t *HTTPTransport) Close() {
+	t.client.Transport.(*http.Transport).CloseIdleConnections()
+}
+
+type transportHandler struct {
+	sm      StateMachine
+	codec   Codec
+	maxSize int64
+}
+
+// TransportHandler returns an http.Handler that decodes the requests sent by
+// HTTPTransport using codec and applies them using sm. If codec is nil,
+// GobCodec(nil) is used. Requests are handled concurrently, hence sm must be
+// safe for concurrent use; see SyncStateMachine. Requests larger than
+// TransportMaxRequestSize are rejected.
+func TransportHandler(sm StateMachine, codec Codec) http.Handler {
+	if codec == nil {
+		codec = GobCodec(nil)
+	}
+	return transportHandler{
+		sm:      sm,
+		codec:   codec,
+		maxSize: TransportMaxRequestSize,
+	}
+}
+
+func (h transportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "raft: transport accepts only POST",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, h.maxSize))
+	if err != nil {
+		var merr *http.MaxBytesError
+		if errors.As(err, &merr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, err := h.codec.Decode(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The request is applied from here on, hence failures must not be reported
+	// as if the request was rejected.
+	res, aerr := h.sm.Apply(req)
+	if b, err = h.codec.Encode(res); err != nil {
+		w.Header().Set(transportEncodeErrorHeader, err.Error())
+		b = nil
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if aerr != nil {
+		w.Header().Set(transportErrorHeader, aerr.Error())
+	}
+	w.Write(b)
+}
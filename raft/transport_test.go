@@ -0,0 +1,212 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTransportNode struct {
+	store *MapStore
+	srv   *httptest.Server
+	trans *HTTPTransport
+}
+
+func newTestTransportNode(c Codec) *testTransportNode {
+	s := NewMapStore()
+	return &testTransportNode{
+		store: s,
+		srv:   httptest.NewServer(TransportHandler(SyncStateMachine(s), c)),
+		trans: NewHTTPTransport(2, time.Second, c),
+	}
+}
+
+func (n *testTransportNode) close() {
+	n.trans.Close()
+	n.srv.Close()
+}
+
+func TestHTTPTransport(t *testing.T) {
+	testHTTPTransport(t, nil)
+}
+
+func TestHTTPTransportJSON(t *testing.T) {
+	testHTTPTransport(t, JSONCodec(nil))
+}
+
+func testHTTPTransport(t *testing.T, c Codec) {
+	a := newTestTransportNode(c)
+	defer a.close()
+	b := newTestTransportNode(c)
+	defer b.close()
+	a.trans.AddPeer("b", b.srv.Listener.Addr().String())
+	b.trans.AddPeer("a", a.srv.Listener.Addr().String())
+
+	_, err := a.trans.Send("b", SetCmd{Key: "k", Val: []byte("a")})
+	if err != nil {
+		t.Fatalf("cannot send to b: %v", err)
+	}
+	_, err = b.trans.Send("a", SetCmd{Key: "k", Val: []byte("b")})
+	if err != nil {
+		t.Fatalf("cannot send to a: %v", err)
+	}
+
+	for _, test := range []struct {
+		n    *testTransportNode
+		peer string
+		want string
+	}{
+		{n: a, peer: "b", want: "a"},
+		{n: b, peer: "a", want: "b"},
+	} {
+		res, err := test.n.trans.Send(test.peer, GetCmd{Key: "k"})
+		if err != nil {
+			t.Fatalf("cannot get from %v: %v", test.peer, err)
+		}
+		if !bytes.Equal(res.([]byte), []byte(test.want)) {
+			t.Errorf("invalid value on %v: actual=%q want=%q", test.peer, res,
+				test.want)
+		}
+	}
+
+	if a.store.Len() != 1 || b.store.Len() != 1 {
+		t.Errorf("invalid number of keys: a=%d b=%d", a.store.Len(),
+			b.store.Len())
+	}
+
+	_, err = a.trans.Send("b", GetCmd{Key: "none"})
+	if err == nil || err.Error() != ErrNoSuchKey.Error() {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchKey)
+	}
+}
+
+func TestHTTPTransportErrors(t *testing.T) {
+	n := newTestTransportNode(nil)
+	defer n.close()
+
+	if _, err := n.trans.Send("b", GetCmd{}); !errors.Is(err, ErrNoSuchPeer) {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchPeer)
+	}
+
+	n.trans.AddPeer("self", n.srv.Listener.Addr().String())
+	_, err := n.trans.Send("self", struct{ X int }{})
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("invalid error for an unregistered request type: actual=%v "+
+			"want=%v", err, ErrUnknownCommand)
+	}
+
+	res, err := n.srv.Client().Get(n.srv.URL + TransportPath)
+	if err != nil {
+		t.Fatalf("cannot get: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode == 200 {
+		t.Error("transport handler accepts GET")
+	}
+
+	jt := NewHTTPTransport(1, time.Second, JSONCodec(nil))
+	defer jt.Close()
+	jt.AddPeer("gob", n.srv.Listener.Addr().String())
+	_, err = jt.Send("gob", GetCmd{})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("invalid error for mismatched codecs: %v", err)
+	}
+
+	n.trans.RemovePeer("self")
+	_, err = n.trans.Send("self", GetCmd{})
+	if err == nil || !strings.Contains(err.Error(), "self") {
+		t.Errorf("invalid error for a removed peer: %v", err)
+	}
+}
+
+// testUnencodableStore applies requests on its MapStore and returns a
+// response of an unregistered type along with the error of the MapStore.
+type testUnencodableStore struct {
+	*MapStore
+}
+
+func (s testUnencodableStore) Apply(req interface{}) (interface{}, error) {
+	_, err := s.MapStore.Apply(req)
+	return struct{ X int }{}, err
+}
+
+func TestHTTPTransportUnencodableResponse(t *testing.T) {
+	s := NewMapStore()
+	srv := httptest.NewServer(TransportHandler(testUnencodableStore{s}, nil))
+	defer srv.Close()
+	trans := NewHTTPTransport(1, time.Second, nil)
+	defer trans.Close()
+	trans.AddPeer("p", srv.Listener.Addr().String())
+
+	_, err := trans.Send("p", SetCmd{Key: "k"})
+	if !errors.Is(err, ErrResponseNotEncodable) {
+		t.Errorf("invalid error: actual=%v want=%v", err,
+			ErrResponseNotEncodable)
+	}
+	if s.Len() != 1 {
+		t.Error("request is not applied")
+	}
+
+	_, err = trans.Send("p", GetCmd{Key: "none"})
+	if !errors.Is(err, ErrResponseNotEncodable) {
+		t.Errorf("invalid error: actual=%v want=%v", err,
+			ErrResponseNotEncodable)
+	}
+	if err == nil || !strings.Contains(err.Error(), ErrNoSuchKey.Error()) {
+		t.Errorf("apply error is lost: actual=%v want=%v", err, ErrNoSuchKey)
+	}
+}
+
+func TestHTTPTransportRequestTooLarge(t *testing.T) {
+	small := SetCmd{Key: "k"}
+	b, err := GobCodec(nil).Encode(small)
+	if err != nil {
+		t.Fatalf("cannot encode: %v", err)
+	}
+	s := NewMapStore()
+	srv := httptest.NewServer(transportHandler{
+		sm:      SyncStateMachine(s),
+		codec:   GobCodec(nil),
+		maxSize: int64(len(b)),
+	})
+	defer srv.Close()
+	trans := NewHTTPTransport(1, time.Second, nil)
+	defer trans.Close()
+	trans.AddPeer("p", srv.Listener.Addr().String())
+
+	if _, err := trans.Send("p", small); err != nil {
+		t.Fatalf("cannot send a small request: %v", err)
+	}
+	big := SetCmd{Key: "k", Val: bytes.Repeat([]byte{'v'}, 128)}
+	_, err = trans.Send("p", big)
+	if err == nil || !strings.Contains(err.Error(), "413") {
+		t.Errorf("invalid error: actual=%v want=%v", err,
+			http.StatusRequestEntityTooLarge)
+	}
+	if v, _ := s.Apply(GetCmd{Key: "k"}); len(v.([]byte)) != 0 {
+		t.Error("large request is applied")
+	}
+}
+
+func TestHTTPTransportTimeout(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) { <-block }))
+	defer srv.Close()
+	defer close(block)
+	trans := NewHTTPTransport(1, 20*time.Millisecond, nil)
+	defer trans.Close()
+	trans.AddPeer("hung", srv.Listener.Addr().String())
+
+	start := time.Now()
+	if _, err := trans.Send("hung", GetCmd{}); err == nil {
+		t.Error("no error for a hung peer")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("send did not time out promptly: %v", d)
+	}
+}
@@ -0,0 +1,94 @@
+package raft
+
+import (
+	"fmt"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+)
+
+// TypedStateMachine is a StateMachine with typed requests and responses. Use
+// Untyped to pass a TypedStateMachine to the node, and Typed to use an existing
+// StateMachine through a typed API.
+type TypedStateMachine[Req, Resp any] interface {
+	Persistent
+	// Apply applies a request and returns the response.
+	Apply(req Req) (Resp, error)
+	// ApplyConfChange processes a configuration change.
+	ApplyConfChange(cc raftpb.ConfChange, gn GroupNode) error
+	// ProcessStatusChange is called whenever the leader of the quorum is changed.
+	ProcessStatusChange(event interface{})
+}
+
+type untyped[Req, Resp any] struct {
+	TypedStateMachine[Req, Resp]
+}
+
+// Untyped returns a StateMachine that applies requests of type Req using ts.
+// Requests of other types are rejected with an error.
+func Untyped[Req, Resp any](ts TypedStateMachine[Req, Resp]) StateMachine {
+	if t, ok := ts.(typed[Req, Resp]); ok {
+		return t.sm
+	}
+	return untyped[Req, Resp]{TypedStateMachine: ts}
+}
+
+func (u untyped[Req, Resp]) Apply(req interface{}) (interface{}, error) {
+	r, ok := req.(Req)
+	if !ok {
+		return nil, fmt.Errorf("raft: request type %T: %w", req,
+			ErrUnknownCommand)
+	}
+	return u.TypedStateMachine.Apply(r)
+}
+
+func (u untyped[Req, Resp]) Reset() error {
+	return Reset(u.TypedStateMachine)
+}
+
+type typed[Req, Resp any] struct {
+	sm StateMachine
+}
+
+// Typed returns a TypedStateMachine that applies requests using sm. A nil
+// response of sm is returned as the zero value of Resp, and responses of other
+// types are returned as errors.
+func Typed[Req, Resp any](sm StateMachine) TypedStateMachine[Req, Resp] {
+	if u, ok := sm.(untyped[Req, Resp]); ok {
+		return u.TypedStateMachine
+	}
+	return typed[Req, Resp]{sm: sm}
+}
+
+func (t typed[Req, Resp]) Save() ([]byte, error) {
+	return t.sm.Save()
+}
+
+func (t typed[Req, Resp]) Restore(b []byte) error {
+	return t.sm.Restore(b)
+}
+
+func (t typed[Req, Resp]) Apply(req Req) (resp Resp, err error) {
+	res, err := t.sm.Apply(req)
+	if res == nil {
+		return resp, err
+	}
+	resp, ok := res.(Resp)
+	if !ok {
+		return resp, fmt.Errorf("raft: invalid response type %T", res)
+	}
+	return resp, err
+}
+
+func (t typed[Req, Resp]) Reset() error {
+	return Reset(t.sm)
+}
+
+func (t typed[Req, Resp]) ApplyConfChange(cc raftpb.ConfChange,
+	gn GroupNode) error {
+
+	return t.sm.ApplyConfChange(cc, gn)
+}
+
+func (t typed[Req, Resp]) ProcessStatusChange(event interface{}) {
+	t.sm.ProcessStatusChange(event)
+}
@@ -0,0 +1,96 @@
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kandoo/beehive/Godeps/_workspace/src/github.com/coreos/etcd/raft/raftpb"
+)
+
+type testTypedCounter struct {
+	n int64
+}
+
+func (c *testTypedCounter) Save() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(c.n))
+	return b, nil
+}
+
+func (c *testTypedCounter) Restore(b []byte) error {
+	if len(b) != 8 {
+		return errors.New("invalid counter snapshot")
+	}
+	c.n = int64(binary.BigEndian.Uint64(b))
+	return nil
+}
+
+func (c *testTypedCounter) Apply(delta int64) (int64, error) {
+	c.n += delta
+	return c.n, nil
+}
+
+func (c *testTypedCounter) ApplyConfChange(cc raftpb.ConfChange,
+	gn GroupNode) error {
+
+	return nil
+}
+
+func (c *testTypedCounter) ProcessStatusChange(event interface{}) {}
+
+var _ TypedStateMachine[int64, int64] = &testTypedCounter{}
+
+func TestUntyped(t *testing.T) {
+	sm := Untyped[int64, int64](&testTypedCounter{})
+	for i := int64(1); i <= 3; i++ {
+		res, err := sm.Apply(i)
+		if err != nil {
+			t.Fatalf("cannot apply %d: %v", i, err)
+		}
+		if want := i * (i + 1) / 2; res.(int64) != want {
+			t.Errorf("invalid response: actual=%v want=%v", res, want)
+		}
+	}
+	if _, err := sm.Apply("invalid"); err == nil {
+		t.Error("no error for an invalid request type")
+	}
+
+	b, err := sm.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	c := &testTypedCounter{}
+	if err := Untyped[int64, int64](c).Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if c.n != 6 {
+		t.Errorf("invalid restored counter: actual=%d want=%d", c.n, 6)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	ts := Typed[GetCmd, []byte](NewMapStore())
+	if _, err := ts.Apply(GetCmd{Key: "k"}); err != ErrNoSuchKey {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrNoSuchKey)
+	}
+
+	c := &testTypedCounter{}
+	if round := Typed[int64, int64](Untyped[int64, int64](c)); round != c {
+		t.Errorf("typed round trip is wrapped: %#v", round)
+	}
+
+	ti := Typed[int64, string](Untyped[int64, int64](c))
+	if _, err := ti.Apply(1); err == nil {
+		t.Error("no error for an invalid response type")
+	}
+}
+
+func ExampleUntyped() {
+	var sm StateMachine = Untyped[int64, int64](&testTypedCounter{})
+	sm.Apply(int64(2))
+	res, _ := sm.Apply(int64(3))
+	fmt.Println(res)
+	// Output: 5
+}
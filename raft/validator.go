@@ -0,0 +1,38 @@
+package raft
+
+// Validator validates requests before they are applied.
+type Validator interface {
+	// Validate returns an error if req must not be applied.
+	Validate(req interface{}) error
+}
+
+// ValidatorFunc is an adapter to use a function as a Validator.
+type ValidatorFunc func(req interface{}) error
+
+// Validate calls f(req).
+func (f ValidatorFunc) Validate(req interface{}) error {
+	return f(req)
+}
+
+// ValidationMiddleware returns a middleware that rejects the requests that
+// are not valid according to v. Rejected requests are not passed to the next
+// ApplyFunc, and the validation error is returned as the response error.
+func ValidationMiddleware(v Validator) Middleware {
+	return func(next ApplyFunc) ApplyFunc {
+		return func(req interface{}) (interface{}, error) {
+			if err := v.Validate(req); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}
+}
+
+// WithValidation returns a state machine that validates requests using v
+// before applying them using sm. If v is nil, sm must implement Validator.
+func WithValidation(sm StateMachine, v Validator) StateMachine {
+	if v == nil {
+		v = sm.(Validator)
+	}
+	return Chain(sm, ValidationMiddleware(v))
+}
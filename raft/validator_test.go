@@ -0,0 +1,40 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWithValidation(t *testing.T) {
+	errEmptyKey := errors.New("empty key")
+	v := ValidatorFunc(func(req interface{}) error {
+		if r, ok := req.(SetCmd); ok && r.Key == "" {
+			return errEmptyKey
+		}
+		return nil
+	})
+
+	s := NewMapStore()
+	sm := WithValidation(s, v)
+	if _, err := sm.Apply(SetCmd{Key: "k", Val: []byte("v")}); err != nil {
+		t.Fatalf("cannot apply a valid request: %v", err)
+	}
+	before, err := sm.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	if _, err := sm.Apply(SetCmd{Key: "", Val: []byte("v")}); err !=
+		errEmptyKey {
+
+		t.Errorf("invalid error: actual=%v want=%v", err, errEmptyKey)
+	}
+	after, err := sm.Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("invalid request changed the snapshot")
+	}
+}
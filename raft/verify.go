@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+var (
+	// ErrFingerprintMismatch is returned when a restored state does not match
+	// the fingerprint of its snapshot.
+	ErrFingerprintMismatch = newKindError("raft: snapshot fingerprint mismatch",
+		ErrSnapshotCorrupt)
+)
+
+// Verifiable is implemented by states that can compute a fingerprint of their
+// contents. Two states with the same contents must have the same fingerprint,
+// e.g., a hash over a canonical encoding of the state.
+type Verifiable interface {
+	// Fingerprint returns the fingerprint of the current state.
+	Fingerprint() ([]byte, error)
+}
+
+// VerifiablePersistent is a Persistent that can compute its fingerprint.
+type VerifiablePersistent interface {
+	Persistent
+	Verifiable
+}
+
+// SaveVerifiable saves p and prefixes the snapshot with its fingerprint. The
+// snapshot should be restored using VerifyRestore.
+func SaveVerifiable(p VerifiablePersistent) ([]byte, error) {
+	fp, err := p.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	d, err := p.Save()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 4+len(fp)+len(d))
+	binary.BigEndian.PutUint32(b, uint32(len(fp)))
+	copy(b[4:], fp)
+	copy(b[4+len(fp):], d)
+	return b, nil
+}
+
+// VerifyRestore restores p from a snapshot saved by SaveVerifiable, and
+// verifies that the fingerprint of the restored state matches the one in the
+// snapshot. This catches corruptions that the decoder of p does not detect.
+// When it returns ErrFingerprintMismatch, p is already restored from the
+// corrupted snapshot and should not be used.
+func VerifyRestore(p VerifiablePersistent, snapshot []byte) error {
+	if len(snapshot) < 4 {
+		return fmt.Errorf("raft: fingerprint header needs 4 bytes, got %d: %w",
+			len(snapshot), ErrSnapshotTooShort)
+	}
+	n := int(binary.BigEndian.Uint32(snapshot))
+	if n > len(snapshot)-4 {
+		return fmt.Errorf("raft: fingerprint of %d bytes in snapshot of %d: %w", n,
+			len(snapshot), ErrSnapshotTooShort)
+	}
+	want := snapshot[4 : 4+n]
+	if err := p.Restore(snapshot[4+n:]); err != nil {
+		return err
+	}
+	fp, err := p.Fingerprint()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(fp, want) {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
+
+type verifiedPersistent struct {
+	p VerifiablePersistent
+}
+
+// VerifiedPersistent returns a Persistent that saves p using SaveVerifiable
+// and restores it using VerifyRestore.
+func VerifiedPersistent(p VerifiablePersistent) Persistent {
+	return verifiedPersistent{p: p}
+}
+
+func (v verifiedPersistent) Save() ([]byte, error) {
+	return SaveVerifiable(v.p)
+}
+
+func (v verifiedPersistent) Restore(b []byte) error {
+	return VerifyRestore(v.p, b)
+}
@@ -0,0 +1,63 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVerifyRestore(t *testing.T) {
+	src := NewMapStore()
+	src.Apply(SetCmd{Key: "a", Val: []byte("1")})
+	src.Apply(SetCmd{Key: "b", Val: []byte("MIDDLE-OF-THE-SNAPSHOT")})
+	src.Apply(SetCmd{Key: "c", Val: []byte("3")})
+	b, err := SaveVerifiable(src)
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	if err := VerifyRestore(NewMapStore(), b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+
+	i := bytes.Index(b, []byte("MIDDLE"))
+	if i < 0 {
+		t.Fatal("cannot find the value in the snapshot")
+	}
+	c := append([]byte(nil), b...)
+	c[i] = 'X'
+
+	fp := int(c[3]) + 4
+	if err := NewMapStore().Restore(c[fp:]); err != nil {
+		t.Fatalf("corruption is detected by the decoder: %v", err)
+	}
+	if err := VerifyRestore(NewMapStore(), c); err != ErrFingerprintMismatch {
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrFingerprintMismatch)
+	}
+}
+
+func TestVerifiedPersistent(t *testing.T) {
+	src := &Counter{n: 42}
+	b, err := VerifiedPersistent(src).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	dst := &Counter{}
+	if err := VerifiedPersistent(dst).Restore(b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if dst.Value() != 42 {
+		t.Errorf("invalid restored value: actual=%v want=%v", dst.Value(), 42)
+	}
+
+	if err := VerifyRestore(dst, []byte{0, 0, 1}); !errors.Is(err,
+		ErrSnapshotTooShort) {
+
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrSnapshotTooShort)
+	}
+	if err := VerifyRestore(dst, []byte{0, 0, 1, 0}); !errors.Is(err,
+		ErrSnapshotTooShort) {
+
+		t.Errorf("invalid error: actual=%v want=%v", err, ErrSnapshotTooShort)
+	}
+}
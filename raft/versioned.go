@@ -0,0 +1,133 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrUnknownVersion is returned when there is no migration from the version
+	// of a snapshot to the current version.
+	ErrUnknownVersion = newKindError("raft: unknown snapshot version",
+		ErrVersionMismatch)
+)
+
+var versionMagic = []byte("bhsv")
+
+const versionHeaderLen = 4 + 4
+
+// MigrationFunc migrates a snapshot payload from one version to another.
+type MigrationFunc func(b []byte) ([]byte, error)
+
+type migration struct {
+	to int
+	fn MigrationFunc
+}
+
+// VersionedPersistent wraps a Persistent and tags its snapshots with a format
+// version. When restoring a snapshot of an older version, the registered
+// migrations are applied in sequence until the payload reaches the current
+// version, and only then is the payload passed to the inner Persistent.
+//
+// Snapshots without a version header, i.e., the ones saved before the store
+// was wrapped in a VersionedPersistent, are considered to be version 0.
+type VersionedPersistent struct {
+	inner   Persistent
+	version int
+
+	mu         sync.RWMutex
+	migrations map[int]migration
+}
+
+// NewVersionedPersistent creates a VersionedPersistent that saves snapshots of
+// inner as the given version. version must be positive.
+func NewVersionedPersistent(inner Persistent,
+	version int) *VersionedPersistent {
+
+	if version <= 0 {
+		panic("raft: snapshot version must be positive")
+	}
+	return &VersionedPersistent{
+		inner:      inner,
+		version:    version,
+		migrations: make(map[int]migration),
+	}
+}
+
+// Version returns the version of the snapshots saved by p.
+func (p *VersionedPersistent) Version() int {
+	return p.version
+}
+
+// RegisterMigration registers fn to migrate payloads of version from to
+// version to. There can be only one migration from each version, and to must
+// be larger than from.
+func (p *VersionedPersistent) RegisterMigration(from, to int,
+	fn MigrationFunc) {
+
+	if to <= from {
+		panic(fmt.Sprintf("raft: invalid migration from v%d to v%d", from, to))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.migrations[from]; ok {
+		panic(fmt.Sprintf("raft: migration from v%d is already registered", from))
+	}
+	p.migrations[from] = migration{to: to, fn: fn}
+}
+
+// Save saves the inner Persistent prefixed with the version header.
+func (p *VersionedPersistent) Save() ([]byte, error) {
+	d, err := p.inner.Save()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, versionHeaderLen+len(d))
+	copy(b, versionMagic)
+	binary.BigEndian.PutUint32(b[4:versionHeaderLen], uint32(p.version))
+	copy(b[versionHeaderLen:], d)
+	return b, nil
+}
+
+// Restore migrates b to the current version and restores it into the inner
+// Persistent.
+func (p *VersionedPersistent) Restore(b []byte) error {
+	v, d := splitVersion(b)
+	d, err := p.migrate(v, d)
+	if err != nil {
+		return err
+	}
+	return p.inner.Restore(d)
+}
+
+func splitVersion(b []byte) (int, []byte) {
+	if len(b) < versionHeaderLen || !bytes.Equal(b[:4], versionMagic) {
+		return 0, b
+	}
+	return int(binary.BigEndian.Uint32(b[4:versionHeaderLen])),
+		b[versionHeaderLen:]
+}
+
+func (p *VersionedPersistent) migrate(v int, d []byte) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for v != p.version {
+		m, ok := p.migrations[v]
+		if !ok || v > p.version {
+			return nil, fmt.Errorf("raft: snapshot version %d, want %d: %w", v,
+				p.version, ErrUnknownVersion)
+		}
+		md, err := m.fn(d)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"raft: cannot migrate snapshot of %d bytes from v%d to v%d: %w",
+				len(d), v, m.to, err)
+		}
+		d, v = md, m.to
+	}
+	return d, nil
+}
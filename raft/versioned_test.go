@@ -0,0 +1,99 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testUserV1 struct {
+	Name string
+}
+
+type testUserV2 struct {
+	First string
+	Last  string
+}
+
+func migrateTestUserV1(b []byte) ([]byte, error) {
+	var u1 testUserV1
+	if err := json.Unmarshal(b, &u1); err != nil {
+		return nil, err
+	}
+	var u2 testUserV2
+	n := strings.SplitN(u1.Name, " ", 2)
+	u2.First = n[0]
+	if len(n) > 1 {
+		u2.Last = n[1]
+	}
+	return json.Marshal(u2)
+}
+
+func TestVersionedPersistentMigration(t *testing.T) {
+	u1 := testUserV1{Name: "John Doe"}
+	b, err := NewVersionedPersistent(JSONPersistent(&u1), 1).Save()
+	if err != nil {
+		t.Fatalf("cannot save v1: %v", err)
+	}
+
+	var u2 testUserV2
+	p := NewVersionedPersistent(JSONPersistent(&u2), 2)
+	if err = p.Restore(b); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("invalid error without migration: actual=%v want=%v", err,
+			ErrUnknownVersion)
+	}
+
+	p.RegisterMigration(1, 2, migrateTestUserV1)
+	if err = p.Restore(b); err != nil {
+		t.Fatalf("cannot restore v1: %v", err)
+	}
+	want := testUserV2{First: "John", Last: "Doe"}
+	if u2 != want {
+		t.Errorf("invalid migrated value: actual=%#v want=%#v", u2, want)
+	}
+
+	b, err = p.Save()
+	if err != nil {
+		t.Fatalf("cannot save v2: %v", err)
+	}
+	u2 = testUserV2{}
+	if err = p.Restore(b); err != nil {
+		t.Fatalf("cannot restore v2: %v", err)
+	}
+	if u2 != want {
+		t.Errorf("invalid restored value: actual=%#v want=%#v", u2, want)
+	}
+}
+
+func TestVersionedPersistentUnversioned(t *testing.T) {
+	u1 := testUserV1{Name: "Jane Roe"}
+	b, err := JSONPersistent(&u1).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+
+	var u2 testUserV2
+	p := NewVersionedPersistent(JSONPersistent(&u2), 2)
+	p.RegisterMigration(0, 1, func(b []byte) ([]byte, error) { return b, nil })
+	p.RegisterMigration(1, 2, migrateTestUserV1)
+	if err = p.Restore(b); err != nil {
+		t.Fatalf("cannot restore an unversioned snapshot: %v", err)
+	}
+	if want := (testUserV2{First: "Jane", Last: "Roe"}); u2 != want {
+		t.Errorf("invalid migrated value: actual=%#v want=%#v", u2, want)
+	}
+}
+
+func TestVersionedPersistentNewer(t *testing.T) {
+	var u testUserV1
+	b, err := NewVersionedPersistent(JSONPersistent(&u), 3).Save()
+	if err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	p := NewVersionedPersistent(JSONPersistent(&u), 2)
+	if err := p.Restore(b); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("invalid error for a newer version: actual=%v want=%v", err,
+			ErrUnknownVersion)
+	}
+}